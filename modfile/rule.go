@@ -155,6 +155,163 @@ func parseToFile(file string, data []byte, fix VersionFixer, strict bool) (*File
 
 var GoVersionRE = lazyregexp.New(`([1-9][0-9]*)\.(0|[1-9][0-9]*)`)
 
+// toolchainRE matches a toolchain name such as go1.21, go1.21.3,
+// go1.21rc2, or go1.22.0-bigcorp, as used in the toolchain directive.
+// The submatches are the major, minor, and patch numbers, the prerelease
+// kind ("beta" or "rc") and number, and the custom suffix.
+var toolchainRE = lazyregexp.New(`^go([1-9][0-9]*)\.(0|[1-9][0-9]*)(?:\.(0|[1-9][0-9]*)|(beta|rc)([1-9][0-9]*))?(?:-([0-9A-Za-z._+-]+))?$`)
+
+// CheckToolchainName checks that s is a valid toolchain name,
+// as in "toolchain go1.21.3". A name is "go" followed by a Go version,
+// goX.Y, goX.Y.Z, or a prerelease such as goX.YrcN or goX.YbetaN,
+// optionally followed by a custom suffix introduced by a hyphen,
+// as in go1.22.0-bigcorp.
+// Unlike the go directive, the name must begin with "go";
+// unlike module versions, it must not begin with "v".
+func CheckToolchainName(s string) error {
+	if !toolchainRE.MatchString(s) {
+		return fmt.Errorf("invalid toolchain name %q: must be of the form go1.23, go1.23.4, go1.23rc1, or go1.23.4-suffix", s)
+	}
+	return nil
+}
+
+// ToolchainCompare returns an integer comparing two toolchain names.
+// The result will be 0 if a == b, -1 if a < b, or +1 if a > b.
+// Names are ordered as Go versions: for a given major and minor version,
+// the name without a patch number, such as go1.21, comes first, followed
+// by the betas, the release candidates, and then the patch releases:
+// go1.21 < go1.21beta1 < go1.21rc2 < go1.21.0 < go1.21.3.
+// A name with a custom suffix, such as go1.22.0-bigcorp, comes just
+// before the same name without the suffix; names differing only in their
+// suffixes are ordered by comparing the suffixes as strings.
+// An invalid toolchain name is considered less than a valid one.
+// All invalid toolchain names compare equal to each other.
+func ToolchainCompare(a, b string) int {
+	ma := toolchainRE.FindStringSubmatch(a)
+	mb := toolchainRE.FindStringSubmatch(b)
+	if ma == nil || mb == nil {
+		switch {
+		case ma == nil && mb == nil:
+			return 0
+		case ma == nil:
+			return -1
+		default:
+			return +1
+		}
+	}
+	if c := compareToolchainNum(ma[1], mb[1]); c != 0 {
+		return c
+	}
+	if c := compareToolchainNum(ma[2], mb[2]); c != 0 {
+		return c
+	}
+	ka, na := toolchainKind(ma)
+	kb, nb := toolchainKind(mb)
+	if ka != kb {
+		if ka < kb {
+			return -1
+		}
+		return +1
+	}
+	if c := compareToolchainNum(na, nb); c != 0 {
+		return c
+	}
+	switch sa, sb := ma[6], mb[6]; {
+	case sa == sb:
+		return 0
+	case sa == "":
+		return +1
+	case sb == "":
+		return -1
+	case sa < sb:
+		return -1
+	default:
+		return +1
+	}
+}
+
+// toolchainKind returns the rank of the kind of release named by the
+// submatches m of toolchainRE, ordered as described for ToolchainCompare,
+// and the patch or prerelease number that orders releases of that kind.
+func toolchainKind(m []string) (rank int, num string) {
+	switch {
+	case m[3] != "":
+		return 3, m[3]
+	case m[4] == "rc":
+		return 2, m[5]
+	case m[4] == "beta":
+		return 1, m[5]
+	}
+	return 0, ""
+}
+
+// compareToolchainNum compares two decimal numbers without leading zeros.
+func compareToolchainNum(x, y string) int {
+	switch {
+	case x == y:
+		return 0
+	case len(x) != len(y):
+		if len(x) < len(y) {
+			return -1
+		}
+		return +1
+	case x < y:
+		return -1
+	default:
+		return +1
+	}
+}
+
+// GoVersionSatisfies reports whether a Go toolchain of version available
+// can build a module whose go directive declares version required;
+// that is, whether available >= required. Both versions are written
+// as in a go directive, such as 1.N, 1.N.M, or 1.NrcM; they are ordered
+// as for ToolchainCompare, so 1.N comes before 1.NrcM, which comes before
+// 1.N.0. An empty required version is always satisfied.
+// An invalid version, including one with a custom toolchain suffix,
+// never satisfies nor is satisfied.
+func GoVersionSatisfies(required, available string) bool {
+	if required == "" {
+		return true
+	}
+	r, a := "go"+required, "go"+available
+	if CheckToolchainName(r) != nil || CheckToolchainName(a) != nil ||
+		strings.Contains(r, "-") || strings.Contains(a, "-") {
+		return false
+	}
+	return ToolchainCompare(a, r) >= 0
+}
+
+// CheckGodebugSetting checks that key=value is a well-formed setting
+// for a godebug directive, as in "godebug default=go1.21".
+// The key must be a non-empty string of ASCII letters, digits, and hyphens.
+// The value must be non-empty and may not contain spaces, commas,
+// equals signs, or quotes. For the key "default", the value must also
+// be a Go version in toolchain form, such as go1.21 or go1.21.3.
+// CheckGodebugSetting does not check that key names a known setting.
+func CheckGodebugSetting(key, value string) error {
+	if key == "" {
+		return fmt.Errorf("invalid godebug setting: empty key")
+	}
+	for _, r := range key {
+		if !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' || r == '-') {
+			return fmt.Errorf("invalid godebug key %q: invalid char %q", key, r)
+		}
+	}
+	if value == "" {
+		return fmt.Errorf("invalid godebug setting %s: empty value", key)
+	}
+	if i := strings.IndexAny(value, " \t,=\"`'"); i >= 0 {
+		return fmt.Errorf("invalid godebug setting %s=%s: invalid char %q", key, value, value[i])
+	}
+	if key == "default" {
+		if err := CheckToolchainName(value); err != nil {
+			return fmt.Errorf("invalid godebug setting default=%s: value must be a Go version like go1.21", value)
+		}
+	}
+	return nil
+}
+
 func (f *File) add(errs *bytes.Buffer, line *Line, verb string, args []string, fix VersionFixer, strict bool) {
 	// If strict is false, this module is a dependency.
 	// We ignore all unknown directives as well as main-module-only
@@ -278,26 +435,16 @@ func (f *File) add(errs *bytes.Buffer, line *Line, verb string, args []string, f
 			return
 		}
 		nv := ""
-		if len(args) == arrow+2 {
-			if !IsDirectoryPath(ns) {
-				fmt.Fprintf(errs, "%s:%d: replacement module without version must be directory path (rooted or starting with ./ or ../)\n", f.Syntax.Name, line.Start.Line)
-				return
-			}
-			if filepath.Separator == '/' && strings.Contains(ns, `\`) {
-				fmt.Fprintf(errs, "%s:%d: replacement directory appears to be Windows path (on a non-windows system)\n", f.Syntax.Name, line.Start.Line)
-				return
-			}
-		}
 		if len(args) == arrow+3 {
 			nv, err = parseVersion(verb, ns, &args[arrow+2], fix)
 			if err != nil {
 				fmt.Fprintf(errs, "%s:%d: %v\n", f.Syntax.Name, line.Start.Line, err)
 				return
 			}
-			if IsDirectoryPath(ns) {
-				fmt.Fprintf(errs, "%s:%d: replacement module directory path %q cannot have version\n", f.Syntax.Name, line.Start.Line, ns)
-				return
-			}
+		}
+		if err := CheckReplaceTarget(ns, nv); err != nil {
+			fmt.Fprintf(errs, "%s:%d: %v\n", f.Syntax.Name, line.Start.Line, err)
+			return
 		}
 		f.Replace = append(f.Replace, &Replace{
 			Old:    module.Version{Path: s, Version: v},
@@ -307,6 +454,114 @@ func (f *File) add(errs *bytes.Buffer, line *Line, verb string, args []string, f
 	}
 }
 
+// CheckReplaceTarget checks the target of a replace directive, the path
+// and version to the right of the "=>". A target with no version must be
+// a directory path, as reported by IsDirectoryPath, and a directory path
+// must not have a version. On systems whose file paths use forward
+// slashes, a directory path containing a backslash is rejected as
+// a Windows path that cannot be used there.
+// CheckReplaceTarget does not check the syntax of a module path or version.
+func CheckReplaceTarget(path, version string) error {
+	if version == "" {
+		if !IsDirectoryPath(path) {
+			return fmt.Errorf("replacement module without version must be directory path (rooted or starting with ./ or ../)")
+		}
+		if filepath.Separator == '/' && strings.Contains(path, `\`) {
+			return fmt.Errorf("replacement directory appears to be Windows path (on a non-windows system)")
+		}
+		return nil
+	}
+	if IsDirectoryPath(path) {
+		return fmt.Errorf("replacement module directory path %q cannot have version", path)
+	}
+	return nil
+}
+
+// CheckReplaces checks a set of replacements, as declared by the replace
+// directives of a go.mod file, keyed by the replaced module version
+// (with an empty Version for a replacement of all versions of a path)
+// and mapping to the replacement module version
+// (with an empty Version for a replacement by a local directory).
+// It reports every problem found, in order of the replaced module versions:
+// each invalid source or target, and each conflict.
+// A source is invalid unless it is a valid module path, with a version,
+// if any, that is valid and matches the path's major version suffix.
+// A target is invalid unless it passes CheckReplaceTarget and,
+// if it has a version, is a valid module path with a valid version.
+// A conflict is a path-only replacement of a path alongside
+// a replacement of a specific version of the same path with a different target.
+// Such a combination is legal but usually a mistake, since the
+// version-specific replacement silently takes precedence.
+// Replacements of different specific versions of a path with different
+// targets are not conflicts: each applies only to its own version, and
+// pointing different versions at different forks or directories is
+// a deliberate and common use of replace.
+func CheckReplaces(replaces map[module.Version]module.Version) []error {
+	var olds []module.Version
+	for old := range replaces {
+		olds = append(olds, old)
+	}
+	module.Sort(olds)
+
+	var errs []error
+	for _, old := range olds {
+		new := replaces[old]
+		if err := checkReplace(old, new); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if old.Version == "" {
+			continue
+		}
+		if all, ok := replaces[module.Version{Path: old.Path}]; ok && all != new {
+			errs = append(errs, &Error{
+				Verb:    "replace",
+				ModPath: old.Path,
+				Err:     fmt.Errorf("conflicting replacements: %s => %s overrides %s => %s", old, replaceTarget(new), old.Path, replaceTarget(all)),
+			})
+		}
+	}
+	return errs
+}
+
+// checkReplace checks that old => new is a valid replacement,
+// as described for CheckReplaces.
+func checkReplace(old, new module.Version) error {
+	if err := module.CheckPath(old.Path); err != nil {
+		return &Error{Verb: "replace", ModPath: old.Path, Err: err}
+	}
+	if old.Version != "" {
+		if err := module.Check(old.Path, old.Version); err != nil {
+			return &Error{Verb: "replace", ModPath: old.Path, Err: err}
+		}
+	}
+	if err := CheckReplaceTarget(new.Path, new.Version); err != nil {
+		return &Error{Verb: "replace", ModPath: old.Path, Err: err}
+	}
+	if new.Version == "" {
+		return nil
+	}
+	if err := module.CheckPath(new.Path); err != nil {
+		return &Error{Verb: "replace", ModPath: old.Path, Err: err}
+	}
+	if module.CanonicalVersion(new.Version) == "" {
+		return &Error{
+			Verb:    "replace",
+			ModPath: old.Path,
+			Err:     &module.InvalidVersionError{Version: new.Version, Err: errors.New("must be of the form v1.2.3")},
+		}
+	}
+	return nil
+}
+
+// replaceTarget returns the replacement new as it would appear in a replace directive.
+func replaceTarget(new module.Version) string {
+	if new.Version == "" {
+		return new.Path
+	}
+	return new.Path + " " + new.Version
+}
+
 // isIndirect reports whether line has a "// indirect" comment,
 // meaning it is in go.mod only for its effect on indirect dependencies,
 // so that it can be dropped entirely once the effective version of the
@@ -7,7 +7,11 @@ package modfile
 import (
 	"bytes"
 	"fmt"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/radeksimko/mod/module"
 )
 
 var addRequireTests = []struct {
@@ -88,3 +92,178 @@ func TestAddRequire(t *testing.T) {
 		})
 	}
 }
+
+var toolchainTests = []string{
+	"go1.9",
+	"go1.9.0",
+	"go1.9.2",
+	"go1.10",
+	"go1.21",
+	"go1.21beta1",
+	"go1.21rc2",
+	"go1.21rc10",
+	"go1.21.0",
+	"go1.21.3",
+	"go1.21.10",
+	"go1.22rc1-bigcorp",
+	"go1.22rc1",
+	"go1.22.0-bigcorp",
+	"go1.22.0-othercorp",
+	"go1.22.0",
+	"go2.0",
+}
+
+func TestToolchainCompare(t *testing.T) {
+	for i, a := range toolchainTests {
+		if err := CheckToolchainName(a); err != nil {
+			t.Errorf("CheckToolchainName(%q): %v", a, err)
+		}
+		for j, b := range toolchainTests {
+			want := 0
+			if i < j {
+				want = -1
+			} else if i > j {
+				want = +1
+			}
+			if c := ToolchainCompare(a, b); c != want {
+				t.Errorf("ToolchainCompare(%q, %q) = %d, want %d", a, b, c, want)
+			}
+		}
+		if c := ToolchainCompare("1.21", a); c != -1 {
+			t.Errorf("ToolchainCompare(%q, %q) = %d, want -1", "1.21", a, c)
+		}
+	}
+
+	for _, bad := range []string{"", "1.21", "v1.21.3", "go1", "go1.021", "go 1.21", "go1.21.3.4", "go1.21.0rc1", "go1.21rc0", "go1.21rc", "go1.21alpha1", "go1.21-", "go1.21 -x", "go1.21-a,b"} {
+		if err := CheckToolchainName(bad); err == nil {
+			t.Errorf("CheckToolchainName(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestCheckReplaces(t *testing.T) {
+	replaces := map[module.Version]module.Version{
+		{Path: "x.y/ok"}:                          {Path: "../ok"},
+		{Path: "x.y/ok2", Version: "v1.0.0"}:      {Path: "x.y/fork", Version: "v1.0.1"},
+		{Path: "x.y/same"}:                        {Path: "../same"},
+		{Path: "x.y/same", Version: "v1.2.0"}:     {Path: "../same"},
+		{Path: "x.y/conflict"}:                    {Path: "../a"},
+		{Path: "x.y/conflict", Version: "v1.2.0"}: {Path: "../b"},
+		{Path: "x.y/dirver"}:                      {Path: "../dir", Version: "v1.0.0"},
+		{Path: "x.y/nover"}:                       {Path: "x.y/other"},
+		{Path: "x.y/badver"}:                      {Path: "x.y/other", Version: "1.0"},
+		{Path: "x.y/z/v2", Version: "v1.0.0"}:     {Path: "../z"},
+		{Path: "bad path"}:                        {Path: "../z"},
+		{Path: "x.y/forks", Version: "v1.0.0"}:    {Path: "x.y/a", Version: "v1.0.0"},
+		{Path: "x.y/forks", Version: "v1.1.0"}:    {Path: "x.y/b", Version: "v1.1.0"},
+	}
+	var got []string
+	for _, err := range CheckReplaces(replaces) {
+		got = append(got, err.Error())
+	}
+	want := []string{
+		`replace bad path: malformed module path "bad path": invalid char ' '`,
+		`replace x.y/badver: version "1.0" invalid: must be of the form v1.2.3`,
+		`replace x.y/conflict: conflicting replacements: x.y/conflict@v1.2.0 => ../b overrides x.y/conflict => ../a`,
+		`replace x.y/dirver: replacement module directory path "../dir" cannot have version`,
+		`replace x.y/nover: replacement module without version must be directory path (rooted or starting with ./ or ../)`,
+		`replace x.y/z/v2: mismatched module path x.y/z/v2 and version v1.0.0 (want /v2)`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("CheckReplaces:\nhave:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+var checkReplaceTargetTests = []struct {
+	path, version string
+	err           string // empty means ok
+}{
+	{"../dir", "", ""},
+	{"/abs/dir", "", ""},
+	{"x.y/fork", "v1.0.0", ""},
+	{"x.y/fork", "", "replacement module without version must be directory path (rooted or starting with ./ or ../)"},
+	{"../dir", "v1.0.0", `replacement module directory path "../dir" cannot have version`},
+	{`C:\dir`, "v1.0.0", `replacement module directory path "C:\\dir" cannot have version`},
+}
+
+func TestCheckReplaceTarget(t *testing.T) {
+	for _, tt := range checkReplaceTargetTests {
+		err := CheckReplaceTarget(tt.path, tt.version)
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("CheckReplaceTarget(%q, %q) = %v, want nil", tt.path, tt.version, err)
+			}
+		} else if err == nil || err.Error() != tt.err {
+			t.Errorf("CheckReplaceTarget(%q, %q) = %v, want %q", tt.path, tt.version, err, tt.err)
+		}
+	}
+
+	err := CheckReplaceTarget(`..\dir`, "")
+	if filepath.Separator == '/' {
+		if err == nil || !strings.Contains(err.Error(), "appears to be Windows path") {
+			t.Errorf("CheckReplaceTarget(%q, \"\") = %v, want Windows path error", `..\dir`, err)
+		}
+	} else if err != nil {
+		t.Errorf("CheckReplaceTarget(%q, \"\") = %v, want nil", `..\dir`, err)
+	}
+}
+
+var goVersionSatisfiesTests = []struct {
+	required, available string
+	ok                  bool
+}{
+	{"", "1.12", true},
+	{"", "", true},
+	{"1.12", "1.12", true},
+	{"1.12", "1.13", true},
+	{"1.21", "1.21.3", true},
+	{"1.21.3", "1.21.10", true},
+	{"1.21.3", "1.21", false},
+	{"1.21", "1.9", false},
+	{"1.21", "2.0", true},
+	{"1.21", "", false},
+	{"1.21", "go1.21", false},
+	{"v1.21", "1.21", false},
+	{"1.21rc2", "1.21.0", true},
+	{"1.21.0", "1.21rc2", false},
+	{"1.21", "1.21rc2", true},
+	{"1.21", "1.21.0-bigcorp", false},
+}
+
+func TestGoVersionSatisfies(t *testing.T) {
+	for _, tt := range goVersionSatisfiesTests {
+		if ok := GoVersionSatisfies(tt.required, tt.available); ok != tt.ok {
+			t.Errorf("GoVersionSatisfies(%q, %q) = %v, want %v", tt.required, tt.available, ok, tt.ok)
+		}
+	}
+}
+
+var godebugSettingTests = []struct {
+	key, value string
+	err        string
+}{
+	{"default", "go1.21", ""},
+	{"default", "go1.21.3", ""},
+	{"panicnil", "1", ""},
+	{"http2-client", "0", ""},
+	{"", "1", `invalid godebug setting: empty key`},
+	{"panic_nil", "1", `invalid godebug key "panic_nil": invalid char '_'`},
+	{"panicnil", "", `invalid godebug setting panicnil: empty value`},
+	{"panicnil", "1,2", `invalid godebug setting panicnil=1,2: invalid char ','`},
+	{"panicnil", "a=b", `invalid godebug setting panicnil=a=b: invalid char '='`},
+	{"default", "1.21", `invalid godebug setting default=1.21: value must be a Go version like go1.21`},
+	{"default", "go1", `invalid godebug setting default=go1: value must be a Go version like go1.21`},
+}
+
+func TestCheckGodebugSetting(t *testing.T) {
+	for _, tt := range godebugSettingTests {
+		err := CheckGodebugSetting(tt.key, tt.value)
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("CheckGodebugSetting(%q, %q): %v", tt.key, tt.value, err)
+			}
+		} else if err == nil || err.Error() != tt.err {
+			t.Errorf("CheckGodebugSetting(%q, %q) = %v, want %q", tt.key, tt.value, err, tt.err)
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package module
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 )
 
 // A ModuleError indicates an error specific to a module.
@@ -48,3 +50,108 @@ func (e *InvalidVersionError) Error() string {
 }
 
 func (e *InvalidVersionError) Unwrap() error { return e.Err }
+
+// An InvalidPathError indicates a module, import, or file path doesn't
+// satisfy all naming constraints. See CheckPath, CheckImportPath,
+// and CheckFilePath for specific restrictions.
+//
+// Callers can use errors.As to tell a malformed path apart from other
+// failures, such as a version that does not match its path in Check.
+// Its message is the same "malformed <kind> path" text as before.
+type InvalidPathError struct {
+	Kind string // "module", "import", or "file"
+	Path string
+	Err  error
+}
+
+func (e *InvalidPathError) Error() string {
+	return fmt.Sprintf("malformed %s path %q: %v", e.Kind, e.Path, e.Err)
+}
+
+func (e *InvalidPathError) Unwrap() error { return e.Err }
+
+// A DeniedPathError reports a well-formed module path rejected by
+// CheckPathDeny because it matches a deny pattern. It is a policy
+// decision, not a syntax error, so it is distinct from InvalidPathError.
+type DeniedPathError struct {
+	Path    string
+	Pattern string // the deny pattern that matched Path
+}
+
+func (e *DeniedPathError) Error() string {
+	return fmt.Sprintf("module path %q: denied host (matches %q)", e.Path, e.Pattern)
+}
+
+// Errors describing why a path is malformed. The Err field of an
+// *InvalidPathError returned by CheckPath, CheckImportPath, or
+// CheckFilePath is either an *InvalidCharError or one of these errors,
+// possibly wrapped with more detail, such as the offending path element.
+// Use errors.Is, or compare the result of Err's Unwrap method if it has one,
+// to tell which check failed without matching message text.
+var (
+	ErrEmptyPath     = errors.New("empty string")
+	ErrInvalidUTF8   = errors.New("invalid UTF-8")
+	ErrDoubleDot     = errors.New("double dot")
+	ErrDoubleSlash   = errors.New("double slash")
+	ErrLeadingSlash  = errors.New("leading slash")
+	ErrTrailingSlash = errors.New("trailing slash")
+	ErrMissingDot    = errors.New("missing dot in first path element")
+	ErrLeadingDash   = errors.New("leading dash in first path element")
+	ErrEmptyElem     = errors.New("empty path element")
+	ErrLeadingDot    = errors.New("leading dot in path element")
+	ErrTrailingDot   = errors.New("trailing dot in path element")
+	ErrDotsElem      = errors.New("path element made up of dots")
+	ErrElemTooLong   = errors.New("path element too long")
+	ErrWindowsName   = errors.New("path element reserved on Windows")
+	ErrMajorSuffix   = errors.New("invalid major version suffix")
+)
+
+// A pathReasonError is a path check failure with a detailed message,
+// wrapping the error that names the check that failed.
+type pathReasonError struct {
+	reason error
+	msg    string
+}
+
+func (e *pathReasonError) Error() string { return e.msg }
+
+func (e *pathReasonError) Unwrap() error { return e.reason }
+
+// pathReason returns an error with the message given by format and args,
+// wrapping reason.
+func pathReason(reason error, format string, args ...interface{}) error {
+	return &pathReasonError{reason: reason, msg: fmt.Sprintf(format, args...)}
+}
+
+// An InvalidCharError reports a character not allowed in a path element.
+// CheckImportPath, CheckPath, and CheckFilePath return it wrapped in an
+// *InvalidPathError, with offsets giving the position of the character
+// in the whole path, so that editors can point at it.
+type InvalidCharError struct {
+	Char       rune
+	Offset     int // byte offset of Char in the path
+	RuneOffset int // offset of Char in the path, counted in runes
+
+	firstElem bool // Char is in the first element of a module path
+}
+
+func (e *InvalidCharError) Error() string {
+	if e.firstElem {
+		return fmt.Sprintf("invalid char %q in first path element", e.Char)
+	}
+	return fmt.Sprintf("invalid char %q", e.Char)
+}
+
+// pathErrors is the error returned by CheckPaths,
+// holding one error per invalid path.
+type pathErrors []error
+
+func (e pathErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (e pathErrors) Unwrap() []error { return e }
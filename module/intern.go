@@ -0,0 +1,33 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package module
+
+import "sync"
+
+// A PathInterner deduplicates module path strings, so that the many
+// Version values referring to the same module can share a single copy
+// of the path. The zero PathInterner is empty and ready to use.
+// A PathInterner is safe for concurrent use by multiple goroutines.
+type PathInterner struct {
+	paths sync.Map // map[string]string
+}
+
+// Intern returns the canonical copy of path held by in,
+// adding path to in if it is not already present.
+func (in *PathInterner) Intern(path string) string {
+	if p, ok := in.paths.Load(path); ok {
+		return p.(string)
+	}
+	p, _ := in.paths.LoadOrStore(path, path)
+	return p.(string)
+}
+
+// InternVersions replaces the Path field of every element of list
+// with its canonical copy from in.
+func InternVersions(list []Version, in *PathInterner) {
+	for i := range list {
+		list[i].Path = in.Intern(list[i].Path)
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package module
+
+import (
+	"reflect"
+	"testing"
+	"unsafe"
+)
+
+// copies returns a list of n versions whose paths all equal path
+// but are each stored in separately allocated memory.
+func copies(path string, n int) []Version {
+	list := make([]Version, n)
+	for i := range list {
+		list[i] = Version{Path: string([]byte(path)), Version: "v1.0.0"}
+	}
+	return list
+}
+
+// stringData returns the address of the bytes backing s.
+func stringData(s string) uintptr {
+	return (*reflect.StringHeader)(unsafe.Pointer(&s)).Data
+}
+
+func TestInternVersions(t *testing.T) {
+	var in PathInterner
+	list := append(copies("golang.org/x/text", 10), Version{"rsc.io/quote", "v1.5.2"})
+	InternVersions(list, &in)
+
+	data := stringData(list[0].Path)
+	for _, m := range list[:10] {
+		if m.Path != "golang.org/x/text" {
+			t.Fatalf("InternVersions changed path to %q", m.Path)
+		}
+		if stringData(m.Path) != data {
+			t.Errorf("InternVersions did not share storage for %q", m.Path)
+		}
+	}
+	if p := in.Intern(string([]byte("rsc.io/quote"))); stringData(p) != stringData(list[10].Path) {
+		t.Errorf("Intern(%q) did not return the interned copy", p)
+	}
+
+	// Interning paths that are already present must not allocate.
+	allocs := testing.AllocsPerRun(100, func() {
+		InternVersions(list, &in)
+	})
+	if allocs != 0 {
+		t.Errorf("InternVersions of interned paths: %v allocs, want 0", allocs)
+	}
+}
+
+func BenchmarkInternVersions(b *testing.B) {
+	list := copies("golang.org/x/text", 1000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var in PathInterner
+		InternVersions(list, &in)
+	}
+}
@@ -96,8 +96,16 @@ package module
 // Changes to the semantics in this file require approval from rsc.
 
 import (
+	"bufio"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"net/url"
+	pathpkg "path"
+	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"unicode"
 	"unicode/utf8"
@@ -122,6 +130,151 @@ func (m Version) String() string {
 	return m.Path + "@" + m.Version
 }
 
+// DiffString returns the module version in the form "Path Version",
+// with the version in canonical form, matching the layout of a
+// require line in a go.mod file. Unlike String, it is stable under
+// non-semantic rewrites of the version, so it makes a good line
+// format for tools that diff build lists.
+func (m Version) DiffString() string {
+	return m.Path + " " + canonicalOrSelf(m.Version)
+}
+
+// ParseDiffString parses a module version in the form returned by DiffString.
+// The path and version must be separated by white space and must
+// together be valid, as checked by Check.
+// The returned version is in canonical form.
+func ParseDiffString(s string) (Version, error) {
+	f := strings.Fields(s)
+	if len(f) != 2 {
+		return Version{}, fmt.Errorf("malformed module version %q: want path and version", s)
+	}
+	if err := Check(f[0], f[1]); err != nil {
+		return Version{}, err
+	}
+	return Version{Path: f[0], Version: CanonicalVersion(f[1])}, nil
+}
+
+// MarshalText implements encoding.TextMarshaler, returning the
+// module version in the form "Path@Version", as String does.
+// A Version with an empty Version field is marshaled as just its path,
+// with no trailing "@", and UnmarshalText accepts that form in turn.
+// Because Version implements encoding.TextMarshaler, encoding/json
+// encodes it as that string, not as an object with Path and Version fields,
+// and it can be used as a JSON map key.
+//
+// So that every marshaled Version can be unmarshaled again, MarshalText
+// applies the same checks as UnmarshalText and returns their error
+// instead of text that UnmarshalText would reject. In particular,
+// versions that are not semantic versions, such as queries like "latest"
+// or go.sum-style entries like "v1.0.0/go.mod", cannot be marshaled.
+func (m Version) MarshalText() ([]byte, error) {
+	if m.Version == "" {
+		if err := CheckPath(m.Path); err != nil {
+			return nil, err
+		}
+		return []byte(m.Path), nil
+	}
+	if err := Check(m.Path, m.Version); err != nil {
+		return nil, err
+	}
+	return []byte(m.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, parsing text in
+// the form produced by MarshalText, as ParseVersion does.
+func (m *Version) UnmarshalText(text []byte) error {
+	v, err := ParseVersion(string(text))
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+// ParseVersion parses a module version in the form "Path@Version",
+// as returned by String, such as "rsc.io/quote/v3@v3.1.0".
+// The string is split at its last "@", and the path and version must
+// together pass Check. As with a bare module path given to "go get",
+// a string without any "@" is accepted as a path with an empty version;
+// the path must then pass CheckPath.
+func ParseVersion(s string) (Version, error) {
+	i := strings.LastIndex(s, "@")
+	if i < 0 {
+		if err := CheckPath(s); err != nil {
+			return Version{}, err
+		}
+		return Version{Path: s}, nil
+	}
+	path, vers := s[:i], s[i+1:]
+	if err := Check(path, vers); err != nil {
+		return Version{}, err
+	}
+	return Version{Path: path, Version: vers}, nil
+}
+
+// urlSchemes are the URL scheme prefixes removed by StripURLScheme.
+var urlSchemes = []string{
+	"https://",
+	"http://",
+	"git+ssh://",
+	"ssh://",
+}
+
+// StripURLScheme returns the candidate module path for a repository URL,
+// such as one pasted by a user in place of a module path.
+// It removes one leading "https://", "http://", "git+ssh://", or "ssh://"
+// and one trailing ".git" (see TrimGitSuffix), so that
+// "https://github.com/user/repo.git" becomes "github.com/user/repo".
+// Any other input is returned unchanged.
+// StripURLScheme does not check the result: callers should pass it to CheckPath.
+func StripURLScheme(path string) string {
+	for _, scheme := range urlSchemes {
+		if strings.HasPrefix(path, scheme) {
+			path = path[len(scheme):]
+			break
+		}
+	}
+	return TrimGitSuffix(path)
+}
+
+// TrimGitSuffix returns path with a single trailing ".git" removed,
+// as in "github.com/user/repo.git", which becomes "github.com/user/repo".
+// To stay conservative, it leaves path unchanged if it does not end in
+// ".git" or if removing the suffix would leave an empty final element
+// or one ending in a dot, as for "github.com/user/.git".
+func TrimGitSuffix(path string) string {
+	trimmed := strings.TrimSuffix(path, ".git")
+	if trimmed == path || trimmed == "" {
+		return path
+	}
+	if c := trimmed[len(trimmed)-1]; c == '/' || c == '.' {
+		return path
+	}
+	return trimmed
+}
+
+// ParsePathQuery splits s, a module path optionally followed by
+// "@" and a version query, as in "example.com/foo/v2@latest",
+// into the path and the query. The path is checked with CheckPath;
+// the query, which may be a version, a version prefix, or a keyword
+// such as "latest" or "upgrade", is returned as is. If s contains
+// no "@", the query is empty. A path whose last element merely looks
+// like a version, such as "example.com/foo/v2", is left intact:
+// only an explicit "@" introduces a query.
+func ParsePathQuery(s string) (path, query string, err error) {
+	path = s
+	if i := strings.LastIndex(s, "@"); i >= 0 {
+		path, query = s[:i], s[i+1:]
+		if query == "" {
+			return "", "", fmt.Errorf("malformed module query %q: empty query after @", s)
+		}
+	}
+	if err := CheckPath(path); err != nil {
+		return "", "", err
+	}
+	return path, query, nil
+}
+
 // Check checks that a given module path, version pair is valid.
 // In addition to the path being a valid module path
 // and the version being a valid semantic version,
@@ -148,6 +301,159 @@ func Check(path, version string) error {
 	return nil
 }
 
+// CaseMismatch reports whether requiredPath and declaredPath are equal
+// under Unicode case folding but are not identical.
+// This is the usual symptom of a module required as, for example,
+// github.com/User/Repo whose go.mod declares github.com/user/repo.
+// See the package documentation for why two different casings
+// of a module path can never be treated as the same module.
+func CaseMismatch(requiredPath, declaredPath string) bool {
+	return requiredPath != declaredPath && strings.EqualFold(requiredPath, declaredPath)
+}
+
+// CheckNoFoldConflict checks that newPath does not differ only in case
+// from any of the existing paths, as reported by CaseMismatch.
+// If it does, the error names the conflicting existing path.
+// A server can use it to keep, say, rsc.io/QUOTE from clobbering
+// rsc.io/quote in a cache stored on a case-insensitive file system.
+// CheckNoFoldConflict scans existing linearly; callers checking many
+// paths against a large set should index the set by lower-cased path instead.
+func CheckNoFoldConflict(newPath string, existing []string) error {
+	for _, p := range existing {
+		if CaseMismatch(newPath, p) {
+			return fmt.Errorf("module path %q conflicts with existing path %q (differ only in case)", newPath, p)
+		}
+	}
+	return nil
+}
+
+// FromTag returns the module version corresponding to the VCS tag
+// for the module with the given path.
+// Tags commonly omit the leading "v" or the minor and patch numbers,
+// so FromTag first coerces tag to a canonical semantic version,
+// turning "1.2" into "v1.2.0", for example.
+// It returns a *ModuleError if path is invalid, if the tag cannot be
+// coerced to a semantic version, or if the resulting version does not
+// match the major version of path, as checked by Check. In the last two
+// cases, the *ModuleError wraps an *InvalidVersionError naming the tag.
+func FromTag(path, tag string) (Version, error) {
+	if err := CheckPath(path); err != nil {
+		return Version{}, &ModuleError{Path: path, Err: err}
+	}
+	v := semver.Canonical(ensureV(tag))
+	if v == "" {
+		return Version{}, &ModuleError{
+			Path: path,
+			Err:  &InvalidVersionError{Version: tag, Err: errors.New("tag is not a semantic version")},
+		}
+	}
+	_, pathMajor, _ := SplitPathVersion(path)
+	if err := CheckPathMajor(v, pathMajor); err != nil {
+		return Version{}, &ModuleError{
+			Path: path,
+			Err:  &InvalidVersionError{Version: tag, Err: err.(*InvalidVersionError).Err},
+		}
+	}
+	return Version{Path: path, Version: v}, nil
+}
+
+// ensureV returns v with a leading "v" added if it is missing.
+func ensureV(v string) string {
+	if strings.HasPrefix(v, "v") {
+		return v
+	}
+	return "v" + v
+}
+
+// CheckExclude checks that path and version are valid for an exclude
+// directive in a go.mod file. An exclude names one exact module version,
+// so in addition to passing Check, the version must be in canonical form,
+// such as v1.2.0 rather than v1.2, and cannot be a version query such as
+// "latest" or ">v1.2.0".
+func CheckExclude(path, version string) error {
+	cv := CanonicalVersion(version)
+	if cv == "" {
+		return fmt.Errorf("invalid exclude %s@%s: version must be a concrete version like v1.2.3, not a query", path, version)
+	}
+	if cv != version {
+		return fmt.Errorf("invalid exclude %s@%s: version must be canonical (want %s)", path, version, cv)
+	}
+	return Check(path, version)
+}
+
+// NormalizeRequire validates and canonicalizes a require directive for
+// path at version, as a go.mod rewriter would before writing it out.
+// The version is rewritten to canonical form with CanonicalVersion,
+// so that v1.2 becomes v1.2.0, and the result must then pass Check.
+// NormalizeRequire does not decide whether the requirement is indirect,
+// which needs analysis of the whole module graph: it returns the indirect
+// flag unchanged once the pair has been validated.
+func NormalizeRequire(path, version string, indirect bool) (Version, bool, error) {
+	cv := CanonicalVersion(version)
+	if cv == "" {
+		return Version{}, false, fmt.Errorf("invalid require %s@%s: malformed semantic version", path, version)
+	}
+	if err := Check(path, cv); err != nil {
+		return Version{}, false, fmt.Errorf("invalid require %s@%s: %v", path, version, err)
+	}
+	return Version{Path: path, Version: cv}, indirect, nil
+}
+
+// FilterRetracted partitions versions into those not retracted and those
+// retracted by any of the version intervals in retracts, preserving order.
+// Each interval is written as in a go.mod retract directive: either a
+// single version, such as "v1.0.1", or a closed range, such as
+// "[v1.1.0, v1.2.0]". Versions are compared with semver.Compare.
+// FilterRetracted returns an error naming the first malformed interval.
+func FilterRetracted(versions []string, retracts []string) (kept, retracted []string, err error) {
+	type interval struct{ low, high string }
+	var intervals []interval
+	for _, r := range retracts {
+		low, high, err := parseVersionInterval(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		intervals = append(intervals, interval{low, high})
+	}
+	for _, v := range versions {
+		isRetracted := false
+		for _, in := range intervals {
+			if semver.Compare(in.low, v) <= 0 && semver.Compare(v, in.high) <= 0 && semver.IsValid(v) {
+				isRetracted = true
+				break
+			}
+		}
+		if isRetracted {
+			retracted = append(retracted, v)
+		} else {
+			kept = append(kept, v)
+		}
+	}
+	return kept, retracted, nil
+}
+
+// parseVersionInterval parses a version interval as accepted by
+// FilterRetracted and returns its inclusive bounds.
+func parseVersionInterval(s string) (low, high string, err error) {
+	t := strings.TrimSpace(s)
+	if strings.HasPrefix(t, "[") && strings.HasSuffix(t, "]") {
+		f := strings.Split(t[1:len(t)-1], ",")
+		if len(f) != 2 {
+			return "", "", fmt.Errorf("malformed version interval %q: want [low, high]", s)
+		}
+		low, high = strings.TrimSpace(f[0]), strings.TrimSpace(f[1])
+	} else {
+		low, high = t, t
+	}
+	if !semver.IsValid(low) || !semver.IsValid(high) {
+		return "", "", fmt.Errorf("malformed version interval %q: invalid semantic version", s)
+	}
+	if semver.Compare(low, high) > 0 {
+		return "", "", fmt.Errorf("malformed version interval %q: low version greater than high", s)
+	}
+	return low, high, nil
+}
+
 // firstPathOK reports whether r can appear in the first element of a module path.
 // The first element of the path must be an LDH domain name, at least for now.
 // To avoid case ambiguity, the domain name must be entirely lower case.
@@ -214,33 +520,335 @@ func fileNameOK(r rune) bool {
 // this second requirement is replaced by a requirement that the path
 // follow the gopkg.in server's conventions.
 func CheckPath(path string) error {
-	if err := checkPath(path, false); err != nil {
-		return fmt.Errorf("malformed module path %q: %v", path, err)
+	if err := checkModulePath(path); err != nil {
+		return &InvalidPathError{Kind: "module", Path: path, Err: err}
 	}
-	i := strings.Index(path, "/")
-	if i < 0 {
-		i = len(path)
+	return nil
+}
+
+// CheckPaths checks each of paths with CheckPath and reports every
+// invalid path, not only the first. Valid paths are skipped.
+// If all paths are valid, CheckPaths returns nil. Otherwise the error's
+// message lists one failure per line, in the order of paths, and the
+// error has an Unwrap() []error method returning the individual
+// *InvalidPathError values, for use with errors.Is and errors.As.
+func CheckPaths(paths []string) error {
+	var errs pathErrors
+	for _, path := range paths {
+		if err := CheckPath(path); err != nil {
+			errs = append(errs, err)
+		}
 	}
-	if i == 0 {
-		return fmt.Errorf("malformed module path %q: leading slash", path)
+	if len(errs) == 0 {
+		return nil
 	}
-	if !strings.Contains(path[:i], ".") {
-		return fmt.Errorf("malformed module path %q: missing dot in first path element", path)
+	return errs
+}
+
+// CheckPathDeny is like CheckPath but also rejects paths matching
+// any of the glob patterns in denyGlobs, such as "*.example.com"
+// or "github.com/attacker". Each pattern is matched, using path.Match,
+// against the prefix of path having the same number of elements
+// as the pattern, so a one-element pattern denies a whole host and
+// a longer pattern denies the paths under a particular prefix.
+// Malformed patterns are ignored.
+// A malformed path gets the *InvalidPathError from CheckPath;
+// a well-formed but denied path gets a *DeniedPathError.
+func CheckPathDeny(path string, denyGlobs []string) error {
+	if err := CheckPath(path); err != nil {
+		return err
 	}
-	if path[0] == '-' {
-		return fmt.Errorf("malformed module path %q: leading dash in first path element", path)
+	if glob, ok := matchPrefixPatterns(denyGlobs, path); ok {
+		return &DeniedPathError{Path: path, Pattern: glob}
 	}
-	for _, r := range path[:i] {
-		if !firstPathOK(r) {
-			return fmt.Errorf("malformed module path %q: invalid char %q in first path element", path, r)
+	return nil
+}
+
+// matchPrefixPatterns reports whether any pattern in globs
+// matches a prefix of target, as described for CheckPathDeny,
+// and if so returns the first pattern that matches.
+func matchPrefixPatterns(globs []string, target string) (glob string, ok bool) {
+	for _, glob := range globs {
+		glob = strings.Trim(glob, "/")
+		if glob == "" {
+			continue
 		}
+		// Cut target down to the same number of elements as glob.
+		n := strings.Count(glob, "/")
+		prefix := target
+		for i := 0; i < len(target); i++ {
+			if target[i] == '/' {
+				if n == 0 {
+					prefix = target[:i]
+					break
+				}
+				n--
+			}
+		}
+		if n > 0 {
+			// Not enough prefix elements.
+			continue
+		}
+		if matched, _ := pathpkg.Match(glob, prefix); matched {
+			return glob, true
+		}
+	}
+	return "", false
+}
+
+// HasHostPort reports whether the first element of path,
+// by convention a domain name, ends in a :port suffix,
+// as in "localhost:8080/mymod".
+func HasHostPort(path string) bool {
+	_, port := splitHostPort(path)
+	return port != ""
+}
+
+// CheckPathAllowPort is like CheckPath but also accepts a :port suffix
+// on the first path element, for modules served by private hosts
+// on non-standard ports. When a port is present, the host need not
+// contain a dot, so that "localhost:8080/mymod" is accepted.
+// The public module system does not allow ports
+// in module paths: such paths cannot be escaped, fetched through a proxy,
+// or required by modules outside the private environment.
+func CheckPathAllowPort(path string) error {
+	host, port := splitHostPort(path)
+	if port == "" {
+		return CheckPath(path)
+	}
+	if err := checkModulePathHost(host+path[len(host)+1+len(port):], false); err != nil {
+		// Offsets past the host must skip over the removed ":port".
+		if e, ok := err.(*InvalidCharError); ok && e.Offset >= len(host) {
+			e.Offset += 1 + len(port)
+			e.RuneOffset = utf8.RuneCountInString(path[:e.Offset])
+		}
+		return &InvalidPathError{Kind: "module", Path: path, Err: err}
+	}
+	return nil
+}
+
+// splitHostPort returns the host and port of the first element of path,
+// if it has the form host:port with a non-empty decimal port.
+// Otherwise it returns an empty port.
+func splitHostPort(path string) (host, port string) {
+	first := firstElem(path)
+	i := strings.LastIndex(first, ":")
+	if i < 0 || i == len(first)-1 {
+		return first, ""
+	}
+	for j := i + 1; j < len(first); j++ {
+		if first[j] < '0' || '9' < first[j] {
+			return first, ""
+		}
+	}
+	return first[:i], first[i+1:]
+}
+
+// ClassifyPathError reports how a proxy client should treat a failure
+// to find the module with the given path. If path is not a valid module
+// path, no proxy can ever serve it: ClassifyPathError returns
+// retriable == false and the error from CheckPath, and the client need
+// not contact the proxy at all. If path is valid, a "404 Not Found" or
+// "410 Gone" response may only mean that the module has not been
+// published yet: ClassifyPathError returns retriable == true and a nil error.
+func ClassifyPathError(path string) (retriable bool, err error) {
+	if err := CheckPath(path); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// checkModulePath is like CheckPath but returns an error
+// describing why path is invalid without mentioning path.
+func checkModulePath(path string) error {
+	return checkModulePathHost(path, true)
+}
+
+// checkModulePathHost is like checkModulePath but only requires
+// a dot in the first path element if needDot is true.
+func checkModulePathHost(path string, needDot bool) error {
+	if err := checkPath(path, false); err != nil {
+		return err
+	}
+	if err := checkEscapedElemLengths(path); err != nil {
+		return err
+	}
+	if err := checkFirstElem(firstElem(path), needDot); err != nil {
+		return err
 	}
 	if _, _, ok := SplitPathVersion(path); !ok {
-		return fmt.Errorf("malformed module path %q: invalid version", path)
+		return pathReason(ErrMajorSuffix, "invalid version")
+	}
+	return nil
+}
+
+// checkEscapedElemLengths checks that each element of the module path
+// fits in MaxPathElementLength bytes once escaped for the module cache,
+// where escaping adds a "!" before each upper-case letter.
+func checkEscapedElemLengths(path string) error {
+	start, n := 0, 0
+	for i := 0; i <= len(path); i++ {
+		if i == len(path) || path[i] == '/' {
+			if n > MaxPathElementLength {
+				return pathReason(ErrElemTooLong, "path element %q too long (%d bytes escaped, max %d)", path[start:i], n, MaxPathElementLength)
+			}
+			start, n = i+1, 0
+			continue
+		}
+		n++
+		if 'A' <= path[i] && path[i] <= 'Z' {
+			n++
+		}
+	}
+	return nil
+}
+
+// firstElem returns the first element of path, up to the first slash, if any.
+func firstElem(path string) string {
+	if i := strings.Index(path, "/"); i >= 0 {
+		return path[:i]
+	}
+	return path
+}
+
+// checkFirstElem checks that elem is a valid first element of a module path,
+// as described for CheckPath. If needDot is false, elem may be
+// a dotless host name such as "localhost".
+func checkFirstElem(elem string, needDot bool) error {
+	if elem == "" {
+		return ErrLeadingSlash
+	}
+	if needDot && !strings.Contains(elem, ".") {
+		return ErrMissingDot
+	}
+	if elem[0] == '-' {
+		return ErrLeadingDash
+	}
+	for i, r := range elem {
+		if !firstPathOK(r) {
+			// elem begins the path, so its offsets are the path's offsets.
+			return &InvalidCharError{Char: r, Offset: i, RuneOffset: utf8.RuneCountInString(elem[:i]), firstElem: true}
+		}
 	}
 	return nil
 }
 
+// CheckPathStream reads newline-separated module paths from r,
+// checks each one with CheckPath, and writes one line of results
+// per path to w: either "ok <path>" or "error <path>: <reason>".
+// Surrounding white space is trimmed from each line and blank lines are skipped.
+// CheckPathStream returns an error only if reading r or writing w fails;
+// invalid paths are reported in the output, not as an error.
+func CheckPathStream(r io.Reader, w io.Writer) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		path := strings.TrimSpace(scanner.Text())
+		if path == "" {
+			continue
+		}
+		var err error
+		if checkErr := checkModulePath(path); checkErr != nil {
+			_, err = fmt.Fprintf(w, "error %s: %v\n", path, checkErr)
+		} else {
+			_, err = fmt.Fprintf(w, "ok %s\n", path)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// PathDepth returns the number of slash-separated elements in path.
+// For example, PathDepth("golang.org/x/text") == 3.
+// PathDepth("") returns 0.
+func PathDepth(path string) int {
+	if path == "" {
+		return 0
+	}
+	return strings.Count(path, "/") + 1
+}
+
+// likelyModuleDepth is the number of path elements beyond which
+// IsLikelyImportNotModule starts to suspect a package directory.
+// Most module paths are of the form host/owner/repo.
+const likelyModuleDepth = 3
+
+// packageDirNames are element names conventionally used for package
+// directories inside a module rather than for module roots.
+var packageDirNames = []string{
+	"cmd",
+	"internal",
+	"pkg",
+	"testdata",
+	"vendor",
+}
+
+// IsLikelyImportNotModule reports whether path looks like the import path
+// of a package inside a module rather than the path of a module itself.
+// It is a heuristic, meant only for advisory diagnostics:
+// it reports true for paths deeper than host/owner/repo (ignoring any
+// major version suffix) in which one of the extra elements is a name
+// conventionally used for package directories, such as "cmd" or "internal".
+// Callers must still use CheckPath to decide whether a module path is valid.
+func IsLikelyImportNotModule(path string) bool {
+	prefix, _, ok := SplitPathVersion(path)
+	if !ok || PathDepth(prefix) <= likelyModuleDepth {
+		return false
+	}
+	elems := strings.Split(prefix, "/")
+	for _, elem := range elems[likelyModuleDepth:] {
+		for _, name := range packageDirNames {
+			if elem == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// A PathAnalysis describes the properties of a module path
+// that are relevant to its validity and its escaped form.
+type PathAnalysis struct {
+	Valid        bool   // path is a valid module path, as checked by CheckPath
+	FirstElement string // path up to the first slash, usually a domain name
+	HasUppercase bool   // path contains upper-case letters, which are escaped in the module cache
+	EscapedForm  string // result of EscapePath; empty if path is invalid
+	PathMajor    string // major version suffix, as returned by SplitPathVersion
+	IsGopkgIn    bool   // path is a gopkg.in path, with ".vN" major version suffixes
+	Errors       []error
+}
+
+// AnalyzePath reports the properties of the module path path in a single call.
+// Errors lists the reasons path is not a valid module path, if any.
+func AnalyzePath(path string) PathAnalysis {
+	a := PathAnalysis{
+		FirstElement: firstElem(path),
+		IsGopkgIn:    isGopkgIn(path),
+	}
+	for _, r := range path {
+		if 'A' <= r && r <= 'Z' {
+			a.HasUppercase = true
+			break
+		}
+	}
+	if _, pathMajor, ok := SplitPathVersion(path); ok {
+		a.PathMajor = pathMajor
+	}
+	if err := CheckPath(path); err != nil {
+		a.Errors = append(a.Errors, err)
+		return a
+	}
+	esc, err := EscapePath(path)
+	if err != nil {
+		a.Errors = append(a.Errors, err)
+		return a
+	}
+	a.Valid = true
+	a.EscapedForm = esc
+	return a
+}
+
 // CheckImportPath checks that an import path is valid.
 //
 // A valid import path consists of one or more valid path elements
@@ -258,92 +866,620 @@ func CheckPath(path string) error {
 // subtleties of Unicode.
 func CheckImportPath(path string) error {
 	if err := checkPath(path, false); err != nil {
-		return fmt.Errorf("malformed import path %q: %v", path, err)
+		return &InvalidPathError{Kind: "import", Path: path, Err: err}
 	}
 	return nil
 }
 
-// checkPath checks that a general path is valid.
-// It returns an error describing why but not mentioning path.
-// Because these checks apply to both module paths and import paths,
-// the caller is expected to add the "malformed ___ path %q: " prefix.
-// fileName indicates whether the final element of the path is a file name
-// (as opposed to a directory name).
-func checkPath(path string, fileName bool) error {
-	if !utf8.ValidString(path) {
-		return fmt.Errorf("invalid UTF-8")
+// CheckImportComment parses the text of an import comment, as in
+//
+//	package quote // import "rsc.io/quote"
+//
+// and returns the import path it declares. comment is the text
+// following the package clause: an optional leading "//" or "/*"
+// and trailing "*/" are removed, and the remainder, ignoring
+// surrounding spaces and tabs, must be the word import followed by
+// a double-quoted Go string. The path is checked with CheckImportPath.
+func CheckImportComment(comment string) (path string, err error) {
+	text := strings.TrimSpace(comment)
+	if strings.HasPrefix(text, "//") {
+		text = text[2:]
+	} else if strings.HasPrefix(text, "/*") && strings.HasSuffix(text, "*/") && len(text) >= 4 {
+		text = text[2 : len(text)-2]
 	}
-	if path == "" {
-		return fmt.Errorf("empty string")
+	text = strings.TrimSpace(text)
+	rest := strings.TrimPrefix(text, "import")
+	if rest == text || rest == "" || (rest[0] != ' ' && rest[0] != '\t') {
+		return "", fmt.Errorf("malformed import comment %q: want import \"path\"", comment)
 	}
-	if strings.Contains(path, "..") {
-		return fmt.Errorf("double dot")
+	rest = strings.TrimSpace(rest)
+	if !strings.HasPrefix(rest, `"`) {
+		return "", fmt.Errorf("malformed import comment %q: path must be a double-quoted string", comment)
 	}
-	if strings.Contains(path, "//") {
-		return fmt.Errorf("double slash")
+	path, err = strconv.Unquote(rest)
+	if err != nil {
+		return "", fmt.Errorf("malformed import comment %q: invalid quoted path", comment)
 	}
-	if path[len(path)-1] == '/' {
-		return fmt.Errorf("trailing slash")
+	if err := CheckImportPath(path); err != nil {
+		return "", err
 	}
-	elemStart := 0
-	for i, r := range path {
-		if r == '/' {
-			if err := checkElem(path[elemStart:i], fileName); err != nil {
-				return err
-			}
-			elemStart = i + 1
-		}
+	return path, nil
+}
+
+// CheckOptions adjusts the rules applied by CheckImportPathWithOptions.
+// The zero value applies the same rules as CheckImportPath.
+type CheckOptions struct {
+	// AllowUnicode permits Unicode letters in path elements,
+	// in addition to the ASCII characters CheckImportPath allows.
+	// See CheckImportPathWithOptions for the letters that remain disallowed.
+	AllowUnicode bool
+}
+
+// CheckImportPathWithOptions is like CheckImportPath but applies
+// the rules adjusted by opts.
+//
+// With opts.AllowUnicode set, path elements may also contain Unicode
+// letters, subject to the considerations in the package documentation.
+// To keep case folding unambiguous, a letter is rejected if it folds
+// to an ASCII letter, like U+212A ('K' for Kelvin), or if it has more than
+// one other case-equivalent rune, like U+03C3 ('σ'), which shares a fold
+// with both 'Σ' and 'ς'. To keep encodings canonical without a
+// normalization step, a path must be in Unicode Normalization Form C
+// one rune at a time: Unicode marks remain disallowed, so 'é' must be
+// written as the single letter U+00E9, never as 'e' followed by U+0301,
+// and so do letters that NFC replaces or composes with a preceding
+// letter, such as U+1F79 ('ό' with oxia, which NFC maps to U+03CC),
+// U+212B (the Angstrom sign), and the conjoining Hangul jamo,
+// which spell out syllables like '한' that have precomposed forms.
+// Such paths are for private use: the public module ecosystem and the
+// go command accept only ASCII import paths.
+func CheckImportPathWithOptions(path string, opts CheckOptions) error {
+	if !opts.AllowUnicode {
+		return CheckImportPath(path)
 	}
-	if err := checkElem(path[elemStart:], fileName); err != nil {
-		return err
+	if err := checkPathChars(path, false, unicodePathOK); err != nil {
+		return &InvalidPathError{Kind: "import", Path: path, Err: err}
 	}
 	return nil
 }
 
-// checkElem checks whether an individual path element is valid.
-// fileName indicates whether the element is a file name (not a directory name).
-func checkElem(elem string, fileName bool) error {
-	if elem == "" {
-		return fmt.Errorf("empty path element")
+// unicodePathOK reports whether r can appear in an import path element
+// checked by CheckImportPathWithOptions with AllowUnicode set:
+// any character allowed by pathOK, or a non-ASCII Unicode letter
+// that is stable under NFC and has at most one other rune
+// in its case-folding orbit, none of them ASCII.
+func unicodePathOK(r rune) bool {
+	if r < utf8.RuneSelf {
+		return pathOK(r)
 	}
-	if strings.Count(elem, ".") == len(elem) {
-		return fmt.Errorf("invalid path element %q", elem)
+	if !unicode.IsLetter(r) || unicode.Is(nfcUnstableLetters, r) {
+		return false
 	}
-	if elem[0] == '.' && !fileName {
-		return fmt.Errorf("leading dot in path element")
+	n := 0
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		if f < utf8.RuneSelf {
+			return false
+		}
+		n++
 	}
-	if elem[len(elem)-1] == '.' {
-		return fmt.Errorf("trailing dot in path element")
+	return n <= 1
+}
+
+// nfcUnstableLetters holds the Unicode letters that are not stable under
+// Normalization Form C: those that NFC replaces with another character
+// or sequence (canonical singletons and composition exclusions),
+// and those that NFC may compose with a preceding character
+// (the conjoining Hangul jamo).
+var nfcUnstableLetters = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{0x0374, 0x0374, 1},
+		{0x0958, 0x095f, 1},
+		{0x09dc, 0x09dd, 1},
+		{0x09df, 0x09df, 1},
+		{0x0a33, 0x0a36, 3},
+		{0x0a59, 0x0a5b, 1},
+		{0x0a5e, 0x0a5e, 1},
+		{0x0b5c, 0x0b5d, 1},
+		{0x0f43, 0x0f43, 1},
+		{0x0f4d, 0x0f4d, 1},
+		{0x0f52, 0x0f52, 1},
+		{0x0f57, 0x0f57, 1},
+		{0x0f5c, 0x0f5c, 1},
+		{0x0f69, 0x0f69, 1},
+		{0x1100, 0x11ff, 1},
+		{0x1f71, 0x1f7d, 2},
+		{0x1fbb, 0x1fbb, 1},
+		{0x1fbe, 0x1fbe, 1},
+		{0x1fc9, 0x1fcb, 2},
+		{0x1fd3, 0x1fd3, 1},
+		{0x1fdb, 0x1fdb, 1},
+		{0x1fe3, 0x1fe3, 1},
+		{0x1feb, 0x1feb, 1},
+		{0x1ff9, 0x1ffb, 2},
+		{0x2126, 0x2126, 1},
+		{0x212a, 0x212b, 1},
+		{0xf900, 0xfa0d, 1},
+		{0xfa10, 0xfa12, 2},
+		{0xfa15, 0xfa1e, 1},
+		{0xfa20, 0xfa22, 2},
+		{0xfa25, 0xfa26, 1},
+		{0xfa2a, 0xfa6d, 1},
+		{0xfa70, 0xfad9, 1},
+		{0xfb1d, 0xfb1f, 2},
+		{0xfb2a, 0xfb36, 1},
+		{0xfb38, 0xfb3c, 1},
+		{0xfb3e, 0xfb3e, 1},
+		{0xfb40, 0xfb41, 1},
+		{0xfb43, 0xfb44, 1},
+		{0xfb46, 0xfb4e, 1},
+	},
+	R32: []unicode.Range32{
+		{0x16d67, 0x16d68, 1},
+		{0x2f800, 0x2fa1d, 1},
+	},
+}
+
+// ImportPathParts returns the slash-separated directory, within the module
+// with path modulePath, of the package with import path importPath.
+// It returns "", true if importPath is modulePath itself,
+// and ok == false if importPath is not within modulePath.
+// The module path is matched in full, including any major version suffix:
+// within module rsc.io/quote/v2, the package rsc.io/quote/v2/buggy
+// is in directory "buggy", while rsc.io/quote/buggy is not in the module at all.
+func ImportPathParts(modulePath, importPath string) (within string, ok bool) {
+	if importPath == modulePath {
+		return "", true
 	}
-	charOK := pathOK
-	if fileName {
-		charOK = fileNameOK
+	if modulePath == "" || !strings.HasPrefix(importPath, modulePath) || importPath[len(modulePath)] != '/' {
+		return "", false
 	}
-	for _, r := range elem {
-		if !charOK(r) {
-			return fmt.Errorf("invalid char %q", r)
+	return importPath[len(modulePath)+1:], true
+}
+
+// PackagePaths returns the sorted import paths of the packages in the
+// directories subdirs of the module with path modulePath; it is the
+// inverse of ImportPathParts. Each subdir is slash-separated and relative
+// to the module root; "" names the root package, whose import path is
+// modulePath itself. Each resulting path must pass CheckImportPath:
+// PackagePaths returns an error identifying the first subdir that does not.
+func PackagePaths(modulePath string, subdirs []string) ([]string, error) {
+	paths := make([]string, 0, len(subdirs))
+	for _, dir := range subdirs {
+		path := modulePath
+		if dir != "" {
+			path += "/" + dir
+		}
+		if err := CheckImportPath(path); err != nil {
+			return nil, fmt.Errorf("invalid package directory %q: %v", dir, err)
 		}
+		paths = append(paths, path)
 	}
+	sort.Strings(paths)
+	return paths, nil
+}
 
-	// Windows disallows a bunch of path elements, sadly.
-	// See https://docs.microsoft.com/en-us/windows/desktop/fileio/naming-a-file
-	short := elem
-	if i := strings.Index(short, "."); i >= 0 {
-		short = short[:i]
+// Classify reports what kind of path path is: "module" if it is a valid
+// module path, as checked by CheckPath; "import" if it is a valid import
+// path, as checked by CheckImportPath, but not a valid module path,
+// like the standard library path "net/http"; and "invalid" otherwise.
+// Every valid module path is also a valid import path,
+// but Classify reports it as "module".
+func Classify(path string) string {
+	if CheckPath(path) == nil {
+		return "module"
 	}
-	for _, bad := range badWindowsNames {
-		if strings.EqualFold(bad, short) {
-			return fmt.Errorf("%q disallowed as path element component on Windows", short)
+	if CheckImportPath(path) == nil {
+		return "import"
+	}
+	return "invalid"
+}
+
+// EnclosingModule returns the module path, among the module paths declared
+// by moduleDecls, that provides the package with the given import path:
+// the longest declared path that equals importPath or is a prefix of it
+// ending at a slash. A module path without a major version suffix is not
+// considered to enclose import paths continuing with a vN element,
+// since those belong to that major version of the module:
+// rsc.io/quote does not enclose rsc.io/quote/v2/buggy.
+// If no declared module encloses importPath, EnclosingModule returns "", false.
+func EnclosingModule(importPath string, moduleDecls []string) (string, bool) {
+	best, found := "", false
+	for _, mod := range moduleDecls {
+		within, ok := ImportPathParts(mod, importPath)
+		if !ok || found && len(mod) <= len(best) {
+			continue
 		}
+		if _, pathMajor, _ := SplitPathVersion(mod); pathMajor == "" {
+			if _, isMajor := IsMajorVersionDir(firstElem(within)); isMajor {
+				continue
+			}
+		}
+		best, found = mod, true
 	}
-	return nil
+	return best, found
 }
 
-// CheckFilePath checks that a slash-separated file path is valid.
-// The definition of a valid file path is the same as the definition
-// of a valid import path except that the set of allowed characters is larger:
-// all Unicode letters, ASCII digits, the ASCII space character (U+0020),
-// and the ASCII punctuation characters
+// stdlibNames are the names of commonly imported standard library packages
+// that ShadowsStdlib considers confusing as the last element of other paths.
+var stdlibNames = map[string]bool{
+	"bytes":   true,
+	"context": true,
+	"errors":  true,
+	"flag":    true,
+	"fmt":     true,
+	"http":    true,
+	"io":      true,
+	"json":    true,
+	"log":     true,
+	"os":      true,
+	"sort":    true,
+	"strconv": true,
+	"strings": true,
+	"sync":    true,
+	"testing": true,
+	"time":    true,
+	"url":     true,
+}
+
+// ShadowsStdlib reports whether importPath, a path outside the standard
+// library, names a package likely to be confused with a commonly used
+// standard library package, as "example.com/x/http" might be confused
+// with "net/http". It reports true when the first element of importPath
+// contains a dot, as for module paths, and the last element, ignoring
+// any major version suffix, is the name of such a package.
+// ShadowsStdlib is a heuristic meant for advisory diagnostics;
+// packages with these names are perfectly valid.
+func ShadowsStdlib(importPath string) bool {
+	if !strings.Contains(firstElem(importPath), ".") {
+		return false
+	}
+	prefix, _, _ := SplitPathVersion(importPath)
+	i := strings.LastIndex(prefix, "/")
+	return i >= 0 && stdlibNames[prefix[i+1:]]
+}
+
+// GopathDir returns the directory, relative to $GOPATH/src,
+// that holds the package with the given import path in GOPATH mode.
+// The result uses the operating system's path separator.
+// Unlike the module download cache, GOPATH does not escape
+// upper-case letters, so the path is used exactly as given.
+// GopathDir fails if path is not a valid import path.
+func GopathDir(path string) (string, error) {
+	if err := CheckImportPath(path); err != nil {
+		return "", err
+	}
+	return filepath.FromSlash(path), nil
+}
+
+// repoHosts lists the code hosting sites known to RepoRoot,
+// all of which serve repositories at host/user/repo.
+var repoHosts = map[string]bool{
+	"bitbucket.org": true,
+	"github.com":    true,
+	"gitlab.com":    true,
+}
+
+// vcsSuffixes lists the path element suffixes that RepoRoot takes
+// to mark the repository root on hosts it does not otherwise know.
+var vcsSuffixes = []string{".bzr", ".fossil", ".git", ".hg", ".svn"}
+
+// RepoRoot returns the path of the version control repository holding
+// the module or package with the given path, for use in VCS operations.
+// It recognizes these hosting patterns:
+//
+//	github.com/user/repo, gitlab.com/user/repo, bitbucket.org/user/repo
+//	gopkg.in/pkg.vN and gopkg.in/user/pkg.vN
+//
+// For the first three hosts, any further elements, such as a submodule
+// directory or a /vN major version suffix, are removed: RepoRoot of
+// "github.com/user/repo/submod/v2" is "github.com/user/repo".
+// On other hosts, RepoRoot makes a best effort, returning the path up to
+// the first element ending in a version control suffix such as ".git",
+// as in "example.com/repo.git/sub". Otherwise it returns an error:
+// the repository root of a custom host can only be found by the
+// go-import meta tag lookup that the go command performs, so callers
+// may need to handle such paths themselves.
+func RepoRoot(path string) (string, error) {
+	if err := CheckImportPath(path); err != nil {
+		return "", err
+	}
+	elems := strings.Split(path, "/")
+	host := elems[0]
+	if repoHosts[host] {
+		if len(elems) < 3 {
+			return "", &InvalidPathError{Kind: "module", Path: path, Err: fmt.Errorf("%s paths must have the form %s/user/repo", host, host)}
+		}
+		return strings.Join(elems[:3], "/"), nil
+	}
+	if host == "gopkg.in" {
+		for i := 2; i <= 3 && i <= len(elems); i++ {
+			if root := strings.Join(elems[:i], "/"); isGopkgInRoot(root) {
+				return root, nil
+			}
+		}
+		return "", &InvalidPathError{Kind: "module", Path: path, Err: errors.New("gopkg.in paths must have the form gopkg.in/pkg.vN or gopkg.in/user/pkg.vN")}
+	}
+	for i := 1; i < len(elems); i++ {
+		for _, suffix := range vcsSuffixes {
+			if len(elems[i]) > len(suffix) && strings.HasSuffix(elems[i], suffix) {
+				return strings.Join(elems[:i+1], "/"), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("cannot determine repository root for %q: unrecognized host %s", path, host)
+}
+
+// PathFromRepo returns the module path for major version major of the
+// module in directory subdir of the repository whose root module path is
+// repoRoot. It is roughly the inverse of RepoRoot:
+//
+//	PathFromRepo("github.com/user/repo", "", 1)       == "github.com/user/repo"
+//	PathFromRepo("github.com/user/repo", "submod", 2) == "github.com/user/repo/submod/v2"
+//
+// Major versions 0 and 1 take no suffix; higher ones take "/vN".
+// A gopkg.in path always ends in ".vN", so for gopkg.in, subdir must be
+// empty and the suffix is written ".vN", replacing any in repoRoot:
+// PathFromRepo("gopkg.in/yaml.v2", "", 3) == "gopkg.in/yaml.v3".
+// The result must pass CheckPath, as must repoRoot unless it is a
+// gopkg.in path still missing its ".vN". major must not be negative.
+func PathFromRepo(repoRoot, subdir string, major int) (string, error) {
+	if major < 0 {
+		return "", fmt.Errorf("invalid major version %d", major)
+	}
+	var path, pathMajor string
+	if isGopkgIn(repoRoot) {
+		if subdir != "" {
+			return "", &InvalidPathError{Kind: "module", Path: repoRoot, Err: fmt.Errorf("gopkg.in modules cannot be in a subdirectory (%s)", subdir)}
+		}
+		prefix, _, _ := splitGopkgIn(repoRoot)
+		pathMajor = fmt.Sprintf(".v%d", major)
+		path = prefix + pathMajor
+	} else {
+		if err := CheckPath(repoRoot); err != nil {
+			return "", err
+		}
+		path = repoRoot
+		if subdir != "" {
+			path += "/" + subdir
+		}
+		if major >= 2 {
+			pathMajor = fmt.Sprintf("/v%d", major)
+			path += pathMajor
+		}
+	}
+	if err := CheckPath(path); err != nil {
+		return "", err
+	}
+	if _, pm, _ := SplitPathVersion(path); pm != pathMajor {
+		return "", &InvalidPathError{Kind: "module", Path: path, Err: fmt.Errorf("subdirectory %q looks like a major version suffix", subdir)}
+	}
+	return path, nil
+}
+
+// CheckModulePathConsistency checks that moduleLine, the module path
+// declared by the go.mod file in directory relDir of the repository whose
+// root module path is repoRootPath, agrees with that location.
+// moduleLine may be given with or without the leading "module" keyword
+// and quotes, as in `module "example.com/repo/sub"`. relDir is slash-separated
+// and relative to the repository root; "" or "." means the root itself.
+//
+// The expected path is repoRootPath joined with relDir. The declared path
+// may add a major version suffix to it, so that the go.mod in submod
+// may declare either repo/submod or repo/submod/v2. Equally, a go.mod
+// in a major version subdirectory, such as v2, declares repo/v2,
+// which is simply repoRootPath joined with relDir.
+// The usual mistake this catches is a module line copied unchanged
+// from the root go.mod into a nested module.
+func CheckModulePathConsistency(moduleLine, repoRootPath, relDir string) error {
+	declared := strings.TrimSpace(moduleLine)
+	if rest := strings.TrimPrefix(declared, "module"); rest != declared && rest != "" && (rest[0] == ' ' || rest[0] == '\t') {
+		declared = strings.TrimSpace(rest)
+	}
+	if unq, err := strconv.Unquote(declared); err == nil {
+		declared = unq
+	}
+	if err := CheckPath(declared); err != nil {
+		return err
+	}
+	dir := pathpkg.Clean("/" + relDir)[1:]
+	if relDir != "" && relDir != "." && dir != strings.TrimSuffix(relDir, "/") {
+		return fmt.Errorf("invalid module directory %q: must be a clean path relative to the repository root", relDir)
+	}
+	want := repoRootPath
+	if dir != "" {
+		want += "/" + dir
+	}
+	if declared == want {
+		return nil
+	}
+	if prefix, pathMajor, ok := SplitPathVersion(declared); ok && pathMajor != "" && prefix == want {
+		return nil
+	}
+	gomod := "go.mod"
+	if dir != "" {
+		gomod = dir + "/go.mod"
+	}
+	return fmt.Errorf("module path %q declared in %s does not match its location in the repository: want %q, optionally followed by a major version suffix", declared, gomod, want)
+}
+
+// isGopkgInRoot reports whether path is a complete gopkg.in repository
+// path, ending in a .vN major version suffix.
+func isGopkgInRoot(path string) bool {
+	_, pathMajor, ok := splitGopkgIn(path)
+	return ok && pathMajor != ""
+}
+
+// vanityVCS lists the version control systems, and the "mod" module
+// proxy protocol, that CheckVanityMeta accepts in a go-import meta tag.
+var vanityVCS = map[string]bool{
+	"bzr": true,
+	"git": true,
+	"hg":  true,
+	"mod": true,
+	"svn": true,
+}
+
+// vanitySchemes lists the URL schemes CheckVanityMeta accepts
+// for the repository root of a go-import meta tag.
+var vanitySchemes = map[string]bool{
+	"bzr+ssh": true,
+	"git":     true,
+	"git+ssh": true,
+	"http":    true,
+	"https":   true,
+	"ssh":     true,
+	"svn":     true,
+	"svn+ssh": true,
+}
+
+// CheckVanityMeta checks the three fields of a go-import meta tag,
+// as served for a vanity import path such as rsc.io/quote:
+//
+//	<meta name="go-import" content="importPrefix vcs repoRoot">
+//
+// importPrefix must pass CheckPath; vcs must be one of "git", "hg",
+// "svn", "bzr", or "mod"; and repoRoot must be an absolute URL with
+// a host, using a scheme such as https or ssh that the go command can
+// fetch from. For "mod", which names a module proxy, the scheme must be
+// http or https. Each field is reported with its own error message.
+// CheckVanityMeta does not contact the repository.
+func CheckVanityMeta(importPrefix, vcs, repoRoot string) error {
+	if err := CheckPath(importPrefix); err != nil {
+		return fmt.Errorf("invalid go-import import prefix: %v", err)
+	}
+	if !vanityVCS[vcs] {
+		return fmt.Errorf("invalid go-import vcs %q: must be one of bzr, git, hg, mod, svn", vcs)
+	}
+	u, err := url.Parse(repoRoot)
+	if err != nil || u.Host == "" || !vanitySchemes[u.Scheme] {
+		return fmt.Errorf("invalid go-import repo root %q: must be a URL such as https://host/path", repoRoot)
+	}
+	if vcs == "mod" && u.Scheme != "https" && u.Scheme != "http" {
+		return fmt.Errorf("invalid go-import repo root %q: module proxy URL must use https or http", repoRoot)
+	}
+	return nil
+}
+
+// checkPath checks that a general path is valid.
+// It returns an error describing why but not mentioning path.
+// Because these checks apply to both module paths and import paths,
+// the caller is expected to add the "malformed ___ path %q: " prefix.
+// fileName indicates whether the final element of the path is a file name
+// (as opposed to a directory name).
+func checkPath(path string, fileName bool) error {
+	charOK := pathOK
+	if fileName {
+		charOK = fileNameOK
+	}
+	return checkPathChars(path, fileName, charOK)
+}
+
+// checkPathChars is like checkPath but accepts in path elements
+// exactly the characters for which charOK returns true.
+func checkPathChars(path string, fileName bool, charOK func(rune) bool) error {
+	if !utf8.ValidString(path) {
+		return ErrInvalidUTF8
+	}
+	if path == "" {
+		return ErrEmptyPath
+	}
+	if strings.Contains(path, "..") {
+		return ErrDoubleDot
+	}
+	if strings.Contains(path, "//") {
+		return ErrDoubleSlash
+	}
+	if path[len(path)-1] == '/' {
+		return ErrTrailingSlash
+	}
+	elemStart := 0
+	for i, r := range path {
+		if r == '/' {
+			if err := checkElemChars(path[elemStart:i], fileName, charOK); err != nil {
+				return atOffset(err, path, elemStart)
+			}
+			elemStart = i + 1
+		}
+	}
+	if err := checkElemChars(path[elemStart:], fileName, charOK); err != nil {
+		return atOffset(err, path, elemStart)
+	}
+	return nil
+}
+
+// atOffset adjusts err, returned by checkElem for the element of path
+// starting at byte offset start, so that the offsets of an *InvalidCharError
+// are relative to path rather than to the element.
+func atOffset(err error, path string, start int) error {
+	if e, ok := err.(*InvalidCharError); ok {
+		e.Offset += start
+		e.RuneOffset = utf8.RuneCountInString(path[:e.Offset])
+	}
+	return err
+}
+
+// MaxPathElementLength is the maximum length in bytes of a single
+// path element. Most file systems limit file names to 255 bytes,
+// and every path element may become a directory in the module cache.
+// For module paths, the limit applies to the escaped form stored in the
+// module cache (see EscapePath), in which each upper-case letter takes
+// two bytes. Package directories below the module root and files are
+// stored as is, so for import and file paths it applies to the element itself.
+var MaxPathElementLength = 255
+
+// checkElem checks whether an individual path element is valid.
+// fileName indicates whether the element is a file name (not a directory name).
+func checkElem(elem string, fileName bool) error {
+	charOK := pathOK
+	if fileName {
+		charOK = fileNameOK
+	}
+	return checkElemChars(elem, fileName, charOK)
+}
+
+// checkElemChars is like checkElem but accepts exactly
+// the characters for which charOK returns true.
+func checkElemChars(elem string, fileName bool, charOK func(rune) bool) error {
+	if elem == "" {
+		return ErrEmptyElem
+	}
+	if len(elem) > MaxPathElementLength {
+		return pathReason(ErrElemTooLong, "path element %q too long (%d bytes, max %d)", elem, len(elem), MaxPathElementLength)
+	}
+	if strings.Count(elem, ".") == len(elem) {
+		return pathReason(ErrDotsElem, "invalid path element %q", elem)
+	}
+	if elem[0] == '.' && !fileName {
+		return ErrLeadingDot
+	}
+	if elem[len(elem)-1] == '.' {
+		return ErrTrailingDot
+	}
+	for i, r := range elem {
+		if !charOK(r) {
+			return &InvalidCharError{Char: r, Offset: i, RuneOffset: utf8.RuneCountInString(elem[:i])}
+		}
+	}
+
+	// Windows disallows a bunch of path elements, sadly.
+	// See https://docs.microsoft.com/en-us/windows/desktop/fileio/naming-a-file
+	short := elem
+	if i := strings.Index(short, "."); i >= 0 {
+		short = short[:i]
+	}
+	for _, bad := range badWindowsNames {
+		if strings.EqualFold(bad, short) {
+			return pathReason(ErrWindowsName, "%q disallowed as path element component on Windows", short)
+		}
+	}
+	return nil
+}
+
+// CheckFilePath checks that a slash-separated file path is valid.
+// The definition of a valid file path is the same as the definition
+// of a valid import path except that the set of allowed characters is larger:
+// all Unicode letters, ASCII digits, the ASCII space character (U+0020),
+// and the ASCII punctuation characters
 // “!#$%&()+,-.=@[]^_{}~”.
 // (The excluded punctuation characters, " * < > ? ` ' | / \ and :,
 // have special meanings in certain shells or operating systems.)
@@ -353,7 +1489,7 @@ func checkElem(elem string, fileName bool) error {
 // subtleties of Unicode.
 func CheckFilePath(path string) error {
 	if err := checkPath(path, true); err != nil {
-		return fmt.Errorf("malformed file path %q: %v", path, err)
+		return &InvalidPathError{Kind: "file", Path: path, Err: err}
 	}
 	return nil
 }
@@ -393,7 +1529,7 @@ var badWindowsNames = []string{
 // a path whose last path element does not satisfy the constraints
 // applied by CheckPath, such as "example.com/pkg/v1" or "example.com/pkg/v1.2".
 func SplitPathVersion(path string) (prefix, pathMajor string, ok bool) {
-	if strings.HasPrefix(path, "gopkg.in/") {
+	if isGopkgIn(path) {
 		return splitGopkgIn(path)
 	}
 
@@ -415,9 +1551,99 @@ func SplitPathVersion(path string) (prefix, pathMajor string, ok bool) {
 	return prefix, pathMajor, true
 }
 
+// PathMajorSuffix returns the major version named by the suffix of path,
+// without the "/" or "." that introduces it: "v3" for "example.com/m/v3"
+// and for "gopkg.in/yaml.v3", and "v2" for "gopkg.in/yaml.v2-unstable".
+// It returns the empty string for v0 and v1 paths, such as "example.com/m",
+// "gopkg.in/yaml.v0", and "gopkg.in/yaml.v1".
+// PathMajorSuffix returns ok = false, and an empty suffix, when
+// SplitPathVersion would, as for "example.com/m/v1".
+func PathMajorSuffix(path string) (suffix string, ok bool) {
+	_, pathMajor, ok := SplitPathVersion(path)
+	if !ok {
+		return "", false
+	}
+	if pathMajor == "" {
+		return "", true
+	}
+	suffix = strings.TrimSuffix(pathMajor[1:], "-unstable")
+	if suffix == "v0" || suffix == "v1" {
+		return "", true
+	}
+	return suffix, true
+}
+
+// DetectMajorSuffixStyleError reports whether path uses the wrong style
+// of major version suffix for its host: "/vN" on a gopkg.in path,
+// which requires ".vN", or ".vN" on any other path, which requires "/vN".
+// If so, it returns an error suggesting the corrected path.
+// Otherwise it returns nil; it does not otherwise check path.
+func DetectMajorSuffixStyleError(path string) error {
+	i := strings.LastIndex(path, "/")
+	if i < 0 {
+		return nil
+	}
+	dir, elem := path[:i], path[i+1:]
+	if isGopkgIn(path) {
+		if dir != "gopkg.in" && isMajorElem(elem) {
+			return &InvalidPathError{Kind: "module", Path: path, Err: fmt.Errorf("gopkg.in paths use .%s, not /%s (want %q)", elem, elem, dir+"."+elem)}
+		}
+		return nil
+	}
+	j := strings.LastIndex(elem, ".")
+	if j <= 0 || !isMajorElem(elem[j+1:]) {
+		return nil
+	}
+	major := elem[j+1:]
+	want := dir + "/" + elem[:j]
+	if major != "v0" && major != "v1" {
+		want += "/" + major
+	}
+	return &InvalidPathError{Kind: "module", Path: path, Err: fmt.Errorf("only gopkg.in paths use .%s (want %q)", major, want)}
+}
+
+// isMajorElem reports whether elem has the form vN for a decimal number N.
+func isMajorElem(elem string) bool {
+	if len(elem) < 2 || elem[0] != 'v' || elem[1] == '0' && len(elem) > 2 {
+		return false
+	}
+	for i := 1; i < len(elem); i++ {
+		if elem[i] < '0' || '9' < elem[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// IsMajorVersionDir reports whether name is a directory name of the form vN
+// that may hold major version N of a module, as in "rsc.io/quote/v2",
+// and if so returns N. Like the /vN suffix accepted by SplitPathVersion,
+// N must be at least 2 and have no leading zeros or dots, so that
+// "v0", "v1", "v01", and "v2.3" are all rejected.
+func IsMajorVersionDir(name string) (int, bool) {
+	if strings.Contains(name, "/") {
+		return 0, false
+	}
+	_, pathMajor, ok := SplitPathVersion("_/" + name)
+	if !ok || pathMajor == "" {
+		return 0, false
+	}
+	n, err := strconv.Atoi(pathMajor[len("/v"):])
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+// isGopkgIn reports whether path is served by gopkg.in,
+// which uses ".vN" major version suffixes in place of "/vN".
+func isGopkgIn(path string) bool {
+	return strings.HasPrefix(path, "gopkg.in/")
+}
+
 // splitGopkgIn is like SplitPathVersion but only for gopkg.in paths.
 func splitGopkgIn(path string) (prefix, pathMajor string, ok bool) {
-	if !strings.HasPrefix(path, "gopkg.in/") {
+	if !isGopkgIn(path) {
 		return path, "", false
 	}
 	i := len(path)
@@ -438,22 +1664,68 @@ func splitGopkgIn(path string) (prefix, pathMajor string, ok bool) {
 	return prefix, pathMajor, true
 }
 
-// MatchPathMajor reports whether the semantic version v
-// matches the path major version pathMajor.
-func MatchPathMajor(v, pathMajor string) bool {
+// CheckPathMajor returns a non-nil error if the semantic version v
+// does not match the path major version pathMajor, as returned by
+// SplitPathVersion. The error is an *InvalidVersionError explaining
+// the mismatch, such as "should be v0 or v1, not v2",
+// or "not a semantic version" if v is not valid.
+func CheckPathMajor(v, pathMajor string) error {
+	if !semver.IsValid(v) {
+		return &InvalidVersionError{Version: v, Err: errors.New("not a semantic version")}
+	}
 	if strings.HasPrefix(pathMajor, ".v") && strings.HasSuffix(pathMajor, "-unstable") {
 		pathMajor = strings.TrimSuffix(pathMajor, "-unstable")
 	}
-	if strings.HasPrefix(v, "v0.0.0-") && pathMajor == ".v1" {
-		// Allow old bug in pseudo-versions that generated v0.0.0- pseudoversion for gopkg .v1.
-		// For example, gopkg.in/yaml.v2@v2.2.1's go.mod requires gopkg.in/check.v1 v0.0.0-20161208181325-20d25e280405.
-		return true
+	if legacyGopkgInPseudo(pathMajor, v) {
+		return nil
 	}
 	m := semver.Major(v)
 	if pathMajor == "" {
-		return m == "v0" || m == "v1" || semver.Build(v) == "+incompatible"
+		if m == "v0" || m == "v1" || semver.Build(v) == "+incompatible" {
+			return nil
+		}
+		pathMajor = "v0 or v1"
+	} else if pathMajor[0] == '/' || pathMajor[0] == '.' {
+		if m == pathMajor[1:] {
+			return nil
+		}
+		pathMajor = pathMajor[1:]
 	}
-	return (pathMajor[0] == '/' || pathMajor[0] == '.') && m == pathMajor[1:]
+	return &InvalidVersionError{
+		Version: v,
+		Err:     fmt.Errorf("should be %s, not %s", pathMajor, m),
+	}
+}
+
+// MatchPathMajor reports whether the semantic version v
+// matches the path major version pathMajor.
+//
+// MatchPathMajor returns true if and only if CheckPathMajor returns nil.
+func MatchPathMajor(v, pathMajor string) bool {
+	return CheckPathMajor(v, pathMajor) == nil
+}
+
+// IsLegacyGopkgInPseudo reports whether version is a v0.0.0- pseudo-version
+// of a gopkg.in path with major version suffix .v1, such as
+// gopkg.in/check.v1 v0.0.0-20161208181325-20d25e280405.
+// Early versions of the go command generated such pseudo-versions
+// by mistake, and go.mod files in the wild still contain them.
+// MatchPathMajor and Check accept them as a special case,
+// so tools should preserve them rather than report them as errors.
+func IsLegacyGopkgInPseudo(path, version string) bool {
+	if !isGopkgIn(path) || !semver.IsValid(version) {
+		return false
+	}
+	_, pathMajor, ok := SplitPathVersion(path)
+	return ok && legacyGopkgInPseudo(strings.TrimSuffix(pathMajor, "-unstable"), version)
+}
+
+// legacyGopkgInPseudo implements IsLegacyGopkgInPseudo
+// given the path major version suffix.
+func legacyGopkgInPseudo(pathMajor, v string) bool {
+	// Allow old bug in pseudo-versions that generated v0.0.0- pseudoversion for gopkg .v1.
+	// For example, gopkg.in/yaml.v2@v2.2.1's go.mod requires gopkg.in/check.v1 v0.0.0-20161208181325-20d25e280405.
+	return strings.HasPrefix(v, "v0.0.0-") && pathMajor == ".v1"
 }
 
 // CanonicalVersion returns the canonical form of the version string v.
@@ -466,34 +1738,608 @@ func CanonicalVersion(v string) string {
 	return cv
 }
 
+// maxPlausibleDigits is the number of decimal digits beyond which
+// SuspiciousVersion considers a version number implausibly large.
+// Such numbers are usually dates or timestamps used by mistake.
+const maxPlausibleDigits = 5
+
+// SuspiciousVersion reports whether v, although possibly accepted by Check,
+// looks like a mistake, and if so returns a human-readable reason.
+// It flags versions that are not semantic versions at all, the version v0.0.0,
+// versions whose major, minor, or patch number has more than five digits
+// (typically a date, as in v20190101.0.0), and the "+incompatible" suffix
+// on a v0 or v1 version, which Check rejects but lenient code may let through.
+// SuspiciousVersion is a heuristic meant for advisory diagnostics;
+// Check remains the authority on which versions are valid.
+func SuspiciousVersion(v string) (reason string, suspicious bool) {
+	cv := semver.Canonical(v)
+	if cv == "" {
+		return "not a semantic version", true
+	}
+	if cv == "v0.0.0" {
+		return "v0.0.0 is rarely a deliberate release", true
+	}
+	core := strings.TrimPrefix(cv[:len(cv)-len(semver.Prerelease(cv))], "v")
+	for i, n := range strings.Split(core, ".") {
+		if len(n) > maxPlausibleDigits {
+			return fmt.Sprintf("%s version %s is implausibly large", []string{"major", "minor", "patch"}[i], n), true
+		}
+	}
+	if IsIncompatible(v) {
+		if m := semver.Major(v); m == "v0" || m == "v1" {
+			return fmt.Sprintf("+incompatible is meaningless on a %s version", m), true
+		}
+	}
+	return "", false
+}
+
+// IsEmptyVersion reports whether v is the empty version string
+// or the special version "none".
+// In a requirement graph, "none" stands for the absence of a requirement:
+// the go command uses it, for example, in "go get path@none" and when
+// minimal version selection removes a module from the build list.
+// Neither form is a valid semantic version, so Check rejects both;
+// callers processing requirement graphs must filter them out first.
+func IsEmptyVersion(v string) bool {
+	return v == "" || v == "none"
+}
+
+// CompareWithNone is like semver.Compare but also accepts the special
+// version "none", which compares less than every other version,
+// valid or not, and equal only to itself. Minimal version selection
+// relies on this ordering: downgrading a requirement to "none" removes it.
+// Note that only "none" is treated specially; the empty string is
+// an invalid semantic version, ordered as semver.Compare orders it.
+func CompareWithNone(v, w string) int {
+	if v == "none" || w == "none" {
+		switch {
+		case v == w:
+			return 0
+		case v == "none":
+			return -1
+		default:
+			return +1
+		}
+	}
+	return semver.Compare(v, w)
+}
+
+// VersionMatches reports whether the version v matches pattern,
+// which takes one of three forms:
+//
+//   - the empty string, which matches any v at all;
+//   - a major or major.minor version prefix, such as "v1" or "v1.2",
+//     which matches any release version with that major (and minor)
+//     version, such as v1.2.5 or v1.2.0+incompatible; or
+//   - a complete semantic version, such as "v1.2.3" or "v1.2.3-rc.1",
+//     which matches exactly the versions with the same canonical form
+//     (see CanonicalVersion), so that "v1.2.3" matches v1.2.3+meta.
+//
+// A prefix pattern never matches a prerelease: "v1" does not match
+// v1.0.0-rc.1. As for "go get m@v1", a version prefix asks for a release
+// in that line, and treating release candidates as matches would let
+// tooling pick an unstable version the user did not name. A prerelease
+// can always be matched by spelling it out in full.
+// An invalid non-empty pattern matches nothing.
+func VersionMatches(pattern, v string) bool {
+	if pattern == "" {
+		return true
+	}
+	if !semver.IsValid(pattern) || !semver.IsValid(v) {
+		return false
+	}
+	switch pattern {
+	case semver.Major(pattern):
+		return semver.Prerelease(v) == "" && semver.Major(v) == pattern
+	case semver.MajorMinor(pattern):
+		return semver.Prerelease(v) == "" && semver.MajorMinor(v) == pattern
+	}
+	return semver.Canonical(pattern) == semver.Canonical(v)
+}
+
+// SuggestIncompatibleFix reports whether the requirement on path at version
+// uses a "+incompatible" version that is better expressed by requiring the
+// major version suffixed path, as is possible once the module has adopted
+// a go.mod file. If so, it returns that path and version.
+// For example, SuggestIncompatibleFix("github.com/x/y", "v2.1.0+incompatible")
+// returns "github.com/x/y/v2", "v2.1.0", true.
+// SuggestIncompatibleFix returns needsFix == false for versions without
+// the "+incompatible" suffix and for paths that cannot take a /vN suffix.
+func SuggestIncompatibleFix(path, version string) (suggestedPath, suggestedVersion string, needsFix bool) {
+	if semver.Build(version) != "+incompatible" || isGopkgIn(path) {
+		return path, version, false
+	}
+	prefix, pathMajor, ok := SplitPathVersion(path)
+	if !ok || pathMajor != "" {
+		return path, version, false
+	}
+	major := semver.Major(version)
+	if major == "v0" || major == "v1" {
+		return path, version, false
+	}
+	return prefix + "/" + major, stripIncompatible(version), true
+}
+
+// stripIncompatible returns v without any "+incompatible" suffix.
+func stripIncompatible(v string) string {
+	return strings.TrimSuffix(v, "+incompatible")
+}
+
 // Sort sorts the list by Path, breaking ties by comparing Version fields.
 // The Version fields are interpreted as semantic versions (using semver.Compare)
 // optionally followed by a tie-breaking suffix introduced by a slash character,
 // like in "v0.0.1/go.mod".
 func Sort(list []Version) {
 	sort.Slice(list, func(i, j int) bool {
-		mi := list[i]
-		mj := list[j]
+		return less(list[i], list[j])
+	})
+}
+
+// SortStable is like Sort but stable: entries that compare equal,
+// such as v1.2 and v1.2.0 of the same path, keep their original
+// relative order, so the result is deterministic for any given input.
+func SortStable(list []Version) {
+	sort.SliceStable(list, func(i, j int) bool {
+		return less(list[i], list[j])
+	})
+}
+
+// SortByVersionDesc sorts the list by Path, like Sort, but orders the
+// entries for each path by Version from newest to oldest. The whole
+// version comparison of Sort is reversed, including its tie-break on
+// a file suffix, so v1.2.0/go.mod sorts before v1.2.0.
+func SortByVersionDesc(list []Version) {
+	sort.Slice(list, func(i, j int) bool {
+		mi, mj := list[i], list[j]
 		if mi.Path != mj.Path {
 			return mi.Path < mj.Path
 		}
-		// To help go.sum formatting, allow version/file.
-		// Compare semver prefix by semver rules,
-		// file by string order.
-		vi := mi.Version
-		vj := mj.Version
-		var fi, fj string
-		if k := strings.Index(vi, "/"); k >= 0 {
-			vi, fi = vi[:k], vi[k:]
+		return less(mj, mi)
+	})
+}
+
+// Dedup sorts list in the order used by Sort and removes entries that
+// exactly repeat an earlier one, comparing Path and Version as strings.
+// It works in place and returns the shortened list. Entries such as v1.0.0
+// and v1.0.0/go.mod, which are distinct go.sum lines, are both kept,
+// as are v1.2 and v1.2.0, which are spelled differently; entries that
+// Sort considers equal are ordered by their Version strings.
+func Dedup(list []Version) []Version {
+	sort.Slice(list, func(i, j int) bool {
+		return compareSorted(list[i], list[j]) < 0
+	})
+	out := list[:0]
+	for i, m := range list {
+		if i > 0 && m == out[len(out)-1] {
+			continue
 		}
-		if k := strings.Index(vj, "/"); k >= 0 {
-			vj, fj = vj[:k], vj[k:]
+		out = append(out, m)
+	}
+	return out
+}
+
+// SortRequires sorts a list of requirements into the order used
+// for require blocks in formatted go.mod files: by Path, with entries
+// for the same path ordered by Version as in Sort.
+// Like SortStable, SortRequires is stable, so entries that compare equal
+// keep their relative order. Splitting a list into direct and indirect
+// requirements is left to the caller.
+func SortRequires(list []Version) {
+	SortStable(list)
+}
+
+// less reports whether mi sorts before mj in the order used by Sort.
+func less(mi, mj Version) bool {
+	if mi.Path != mj.Path {
+		return mi.Path < mj.Path
+	}
+	// To help go.sum formatting, allow version/file.
+	// Compare semver prefix by semver rules,
+	// file by string order.
+	vi := mi.Version
+	vj := mj.Version
+	var fi, fj string
+	if k := strings.Index(vi, "/"); k >= 0 {
+		vi, fi = vi[:k], vi[k:]
+	}
+	if k := strings.Index(vj, "/"); k >= 0 {
+		vj, fj = vj[:k], vj[k:]
+	}
+	if vi != vj {
+		return semver.Compare(vi, vj) < 0
+	}
+	return fi < fj
+}
+
+// VersionsOf returns the versions of all entries in list whose Path is
+// exactly path, in the order that Sort would place them.
+// The match is case-sensitive, as module paths are.
+// If no entry has the given path, VersionsOf returns an empty list.
+func VersionsOf(list []Version, path string) []string {
+	return versionsOf(list, func(p string) bool { return p == path })
+}
+
+// VersionsOfFold is like VersionsOf but matches paths under Unicode
+// case folding. It is meant for diagnosing lists that may contain
+// miscased module paths; the module system itself never treats
+// two different casings of a path as the same module.
+func VersionsOfFold(list []Version, path string) []string {
+	return versionsOf(list, func(p string) bool { return strings.EqualFold(p, path) })
+}
+
+func versionsOf(list []Version, match func(string) bool) []string {
+	var matched []Version
+	for _, m := range list {
+		if match(m.Path) {
+			matched = append(matched, m)
 		}
-		if vi != vj {
-			return semver.Compare(vi, vj) < 0
+	}
+	Sort(matched)
+	versions := make([]string, len(matched))
+	for i, m := range matched {
+		versions[i] = m.Version
+	}
+	return versions
+}
+
+// PathsAtVersion returns the sorted, distinct paths of the entries
+// in list whose version equals version. It is the transpose of VersionsOf.
+// Versions are compared in canonical form, so that v1.2 matches v1.2.0;
+// versions that are not semantic versions must match exactly.
+// If no entry has the given version, PathsAtVersion returns an empty list.
+func PathsAtVersion(list []Version, version string) []string {
+	want := canonicalOrSelf(version)
+	paths := []string{}
+	seen := make(map[string]bool)
+	for _, m := range list {
+		if !seen[m.Path] && canonicalOrSelf(m.Version) == want {
+			seen[m.Path] = true
+			paths = append(paths, m.Path)
 		}
-		return fi < fj
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// GroupByVersion returns a map from each version in list to the
+// sorted, distinct paths at that version, as PathsAtVersion would return them.
+// Keys are versions in canonical form, so that entries at v1.2 and
+// v1.2.0 are grouped together under v1.2.0. Entries whose version
+// is not a semantic version, such as "v1.2.0/go.mod", are grouped
+// under their exact version string.
+func GroupByVersion(list []Version) map[string][]string {
+	groups := make(map[string][]string)
+	seen := make(map[Version]bool)
+	for _, m := range list {
+		m.Version = canonicalOrSelf(m.Version)
+		if !seen[m] {
+			seen[m] = true
+			groups[m.Version] = append(groups[m.Version], m.Path)
+		}
+	}
+	for _, paths := range groups {
+		sort.Strings(paths)
+	}
+	return groups
+}
+
+// FindEquivalentDuplicates returns the groups of entries in list whose
+// paths name the same module written in different ways. Two paths are
+// equivalent if they are equal after each is normalized by:
+//
+//   - removing a trailing ".git", as TrimGitSuffix does;
+//   - rewriting a mistaken gopkg.in "/vN" suffix to ".vN",
+//     so that gopkg.in/yaml/v2 matches gopkg.in/yaml.v2;
+//   - removing a redundant "/v0" or "/v1" suffix on other paths,
+//     since major versions 0 and 1 take no suffix; and
+//   - mapping upper-case letters to lower case.
+//
+// Versions are ignored. Each group is in Sort order and has more than
+// one member; entries that are exact duplicates of each other are grouped
+// too. The groups are ordered by their first member, in Sort order.
+func FindEquivalentDuplicates(list []Version) [][]Version {
+	byKey := make(map[string][]Version)
+	for _, m := range list {
+		k := equivalentPathKey(m.Path)
+		byKey[k] = append(byKey[k], m)
+	}
+	var groups [][]Version
+	for _, g := range byKey {
+		if len(g) > 1 {
+			Sort(g)
+			groups = append(groups, g)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return less(groups[i][0], groups[j][0])
 	})
+	return groups
+}
+
+// equivalentPathKey returns the normalized form of path
+// used by FindEquivalentDuplicates to compare paths.
+func equivalentPathKey(path string) string {
+	path = TrimGitSuffix(path)
+	if i := strings.LastIndex(path, "/"); i >= 0 && isMajorElem(path[i+1:]) {
+		dir, elem := path[:i], path[i+1:]
+		switch {
+		case isGopkgIn(path):
+			if dir != "gopkg.in" {
+				path = dir + "." + elem
+			}
+		case elem == "v0" || elem == "v1":
+			path = dir
+		}
+	}
+	return strings.ToLower(path)
+}
+
+// canonicalOrSelf returns CanonicalVersion(v),
+// or v itself if v is not a semantic version.
+func canonicalOrSelf(v string) string {
+	if cv := CanonicalVersion(v); cv != "" {
+		return cv
+	}
+	return v
+}
+
+// Hosts returns the sorted, distinct first elements of the module paths
+// in list: the hosts, such as "github.com" or "gopkg.in", from which
+// the modules in the list are fetched. Entries whose paths do not begin
+// with a valid first element, as described for CheckPath, are skipped.
+// If list has no such entries, Hosts returns an empty list.
+func Hosts(list []Version) []string {
+	hosts := []string{}
+	seen := make(map[string]bool)
+	for _, m := range list {
+		host := firstElem(m.Path)
+		if !seen[host] && checkFirstElem(host, true) == nil {
+			seen[host] = true
+			hosts = append(hosts, host)
+		}
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// ListsEqual reports whether the build lists a and b contain the same
+// set of path, version pairs. The order of the lists and any duplicate
+// entries are ignored, and versions are compared in canonical form,
+// so that v1.2 and v1.2.0 are considered equal.
+// Versions that are not semantic versions are compared exactly.
+func ListsEqual(a, b []Version) bool {
+	sa := versionSet(a)
+	sb := versionSet(b)
+	if len(sa) != len(sb) {
+		return false
+	}
+	for m := range sa {
+		if !sb[m] {
+			return false
+		}
+	}
+	return true
+}
+
+// IsMinimal reports whether buildList is exactly the build list that
+// minimal version selection computes for its first entry, the main module,
+// given the requirements of each module version as returned by reqs.
+// That is, every module in buildList must be reachable from the main module
+// through the requirements of the selected versions, each module must
+// appear exactly once, and each module other than the main module must be
+// at the highest version required of it by any reachable module.
+// Requirements on the version "none" are ignored, as are requirements
+// on the main module itself, which is always selected.
+//
+// If buildList is not minimal, IsMinimal returns false and an error
+// describing the first violation found. If reqs fails, IsMinimal
+// returns false and the error from reqs.
+func IsMinimal(buildList []Version, reqs func(Version) ([]Version, error)) (bool, error) {
+	if len(buildList) == 0 {
+		return false, errors.New("empty build list")
+	}
+	selected := make(map[string]Version, len(buildList))
+	for _, m := range buildList {
+		if prev, ok := selected[m.Path]; ok {
+			return false, fmt.Errorf("build list contains both %v and %v", prev, m)
+		}
+		selected[m.Path] = m
+	}
+
+	// Walk the requirement graph from the main module,
+	// recording the highest version required of each module.
+	required := make(map[string]string)
+	reached := map[string]bool{buildList[0].Path: true}
+	queue := []Version{buildList[0]}
+	for len(queue) > 0 {
+		m := queue[0]
+		queue = queue[1:]
+		list, err := reqs(m)
+		if err != nil {
+			return false, err
+		}
+		for _, r := range list {
+			if r.Version == "none" || r.Path == buildList[0].Path {
+				continue
+			}
+			sel, ok := selected[r.Path]
+			if !ok {
+				return false, fmt.Errorf("%v requires %v, missing from build list", m, r)
+			}
+			if semver.Compare(sel.Version, r.Version) < 0 {
+				return false, fmt.Errorf("%v requires %v, but build list has %v", m, r, sel)
+			}
+			if v, ok := required[r.Path]; !ok || semver.Compare(r.Version, v) > 0 {
+				required[r.Path] = r.Version
+			}
+			if !reached[r.Path] {
+				reached[r.Path] = true
+				queue = append(queue, sel)
+			}
+		}
+	}
+
+	for _, m := range buildList[1:] {
+		if !reached[m.Path] {
+			return false, fmt.Errorf("%v is not required by any module in the build list", m)
+		}
+		if v := required[m.Path]; semver.Compare(m.Version, v) != 0 {
+			return false, fmt.Errorf("build list has %v, but highest requirement is %s", m, v)
+		}
+	}
+	return true, nil
+}
+
+// RequirementsRemoved returns the entries of old whose Path
+// does not appear anywhere in new, in the order that Sort would place them.
+// Paths are compared exactly, including case. If such a path appears
+// more than once in old, every entry for it is returned.
+func RequirementsRemoved(old, new []Version) []Version {
+	return pathsNotIn(old, new)
+}
+
+// RequirementsAdded returns the entries of new whose Path
+// does not appear anywhere in old, in the order that Sort would place them.
+// It is the reverse of RequirementsRemoved.
+func RequirementsAdded(old, new []Version) []Version {
+	return pathsNotIn(new, old)
+}
+
+// pathsNotIn returns the sorted entries of list whose paths are absent from other.
+func pathsNotIn(list, other []Version) []Version {
+	have := make(map[string]bool, len(other))
+	for _, m := range other {
+		have[m.Path] = true
+	}
+	var diff []Version
+	for _, m := range list {
+		if !have[m.Path] {
+			diff = append(diff, m)
+		}
+	}
+	Sort(diff)
+	return diff
+}
+
+// Diff compares the lists a and b, which must already be in the order
+// that Sort places them, and returns the entries added in b and those
+// removed from a. Entries are compared by both Path and Version, so an
+// upgrade of a path appears as one removed entry and one added entry.
+// Diff runs in time linear in the lengths of the lists; it gives
+// meaningless results for lists that are not sorted, and for lists
+// holding entries that Sort considers equal but that are spelled
+// differently, such as v1.2 and v1.2.0 of the same path.
+func Diff(a, b []Version) (added, removed []Version) {
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch c := compareSorted(a[i], b[j]); {
+		case c < 0:
+			removed = append(removed, a[i])
+			i++
+		case c > 0:
+			added = append(added, b[j])
+			j++
+		default:
+			i++
+			j++
+		}
+	}
+	removed = append(removed, a[i:]...)
+	added = append(added, b[j:]...)
+	return added, removed
+}
+
+// Intersect returns the entries, compared by both Path and Version,
+// that appear in both a and b. As for Diff, the lists must already be
+// in the order that Sort places them, and Intersect runs in linear time.
+// The result is in the same order.
+func Intersect(a, b []Version) []Version {
+	var both []Version
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch c := compareSorted(a[i], b[j]); {
+		case c < 0:
+			i++
+		case c > 0:
+			j++
+		default:
+			both = append(both, a[i])
+			i++
+			j++
+		}
+	}
+	return both
+}
+
+// compareSorted compares mi and mj in the order used by Sort,
+// breaking ties between entries Sort considers equal by comparing
+// their versions as strings, so that only identical entries compare equal.
+func compareSorted(mi, mj Version) int {
+	switch {
+	case less(mi, mj):
+		return -1
+	case less(mj, mi):
+		return +1
+	}
+	return strings.Compare(mi.Version, mj.Version)
+}
+
+// MergeLists returns the union of the build lists a and b with, as in
+// minimal version selection, only the highest version of each path kept.
+// Versions are compared as in Sort: a "/go.mod"-style suffix after
+// the version is kept separate, so that the highest "v1.2.3/go.mod" entry
+// of a path is selected independently of its highest "v1.2.3" entry,
+// and build metadata such as "+incompatible" does not affect the comparison.
+// When two entries for a path compare equal but are spelled differently,
+// such as v1.2 and v1.2.0, the first one in a, then b, is kept.
+// The result is in the order that Sort would place it.
+func MergeLists(a, b []Version) []Version {
+	type key struct {
+		path string
+		file string
+	}
+	var keys []key
+	max := make(map[key]Version)
+	for _, list := range [][]Version{a, b} {
+		for _, m := range list {
+			k := key{path: m.Path}
+			if i := strings.Index(m.Version, "/"); i >= 0 {
+				k.file = m.Version[i:]
+			}
+			old, ok := max[k]
+			if !ok {
+				keys = append(keys, k)
+			}
+			if !ok || semver.Compare(stripFile(old.Version), stripFile(m.Version)) < 0 {
+				max[k] = m
+			}
+		}
+	}
+	merged := make([]Version, 0, len(keys))
+	for _, k := range keys {
+		merged = append(merged, max[k])
+	}
+	Sort(merged)
+	return merged
+}
+
+// stripFile returns v without any "/file" suffix, as used in go.sum.
+func stripFile(v string) string {
+	if i := strings.Index(v, "/"); i >= 0 {
+		return v[:i]
+	}
+	return v
+}
+
+// versionSet returns the set of entries in list,
+// with versions in canonical form where possible.
+func versionSet(list []Version) map[Version]bool {
+	set := make(map[Version]bool, len(list))
+	for _, m := range list {
+		m.Version = canonicalOrSelf(m.Version)
+		set[m] = true
+	}
+	return set
 }
 
 // EscapePath returns the escaped form of the given module path.
@@ -506,6 +2352,150 @@ func EscapePath(path string) (escaped string, err error) {
 	return escapeString(path)
 }
 
+// EscapePathAppend appends the escaped form of the given module path
+// to dst and returns the extended buffer, like EscapePath but letting
+// callers on hot paths reuse a buffer. It does not allocate unless dst
+// must grow. If the module path is invalid, EscapePathAppend returns dst
+// unchanged and the error from CheckPath.
+func EscapePathAppend(dst []byte, path string) ([]byte, error) {
+	if err := CheckPath(path); err != nil {
+		return dst, err
+	}
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		switch {
+		case c == '!' || c >= utf8.RuneSelf:
+			// This should be disallowed by CheckPath, but diagnose anyway.
+			return dst, fmt.Errorf("internal error: inconsistency in EscapePath")
+		case 'A' <= c && c <= 'Z':
+			dst = append(dst, '!', c+'a'-'A')
+		default:
+			dst = append(dst, c)
+		}
+	}
+	return dst, nil
+}
+
+// RequiresEscaping reports whether the escaped form of path differs
+// from path itself, that is, whether path contains upper-case letters.
+// Unlike EscapePath, it does not check that path is a valid module path,
+// so it can be used on legacy or otherwise unchecked input;
+// a true result does not imply that EscapePath will succeed.
+func RequiresEscaping(path string) bool {
+	for i := 0; i < len(path); i++ {
+		if 'A' <= path[i] && path[i] <= 'Z' {
+			return true
+		}
+	}
+	return false
+}
+
+// EscapePathQuery returns a form of the module path that is safe to use
+// as a value in a URL query string, as in "?mod=github.com/x/y".
+// It fails if the module path is invalid.
+//
+// This is unrelated to the "!" escaping done by EscapePath, which produces
+// path segments for the module cache and the proxy protocol.
+// Module paths are restricted enough that only "+", which denotes
+// a space in query strings, needs percent-encoding; slashes and letters
+// of either case are left alone to keep the result legible.
+func EscapePathQuery(path string) (string, error) {
+	if err := CheckPath(path); err != nil {
+		return "", err
+	}
+	return strings.Replace(path, "+", "%2B", -1), nil
+}
+
+// UnescapePathQuery returns the module path for a URL query value
+// produced by EscapePathQuery or by any other standard query encoding.
+// It fails if the value is not a valid query encoding of a valid module path.
+func UnescapePathQuery(query string) (string, error) {
+	path, err := url.QueryUnescape(query)
+	if err != nil {
+		return "", fmt.Errorf("invalid escaped module path query %q: %v", query, err)
+	}
+	if err := CheckPath(path); err != nil {
+		return "", fmt.Errorf("invalid escaped module path query %q: %v", query, err)
+	}
+	return path, nil
+}
+
+// Escaped returns the escaped forms of m.Path and m.Version,
+// as computed by EscapePath and EscapeVersion.
+// Code storing module versions in the module cache or serving them
+// in the proxy protocol always needs both, and using Escaped
+// ensures that neither half is left unescaped.
+func (m Version) Escaped() (path, version string, err error) {
+	path, err = EscapePath(m.Path)
+	if err != nil {
+		return "", "", err
+	}
+	version, err = EscapeVersion(m.Version)
+	if err != nil {
+		return "", "", err
+	}
+	return path, version, nil
+}
+
+// proxyExts lists the file extensions served by the module proxy
+// protocol for each module version, as accepted by ProxyPath.
+var proxyExts = []string{".info", ".mod", ".zip"}
+
+// ProxyPath returns the path, relative to the root of a module proxy
+// such as $GOPROXY, of the file with extension ext describing m.
+// ext must be one of ".info", ".mod", or ".zip". For example,
+//
+//	ProxyPath(Version{"github.com/Azure/go", "v1.2.0"}, ".info") == "github.com/!azure/go/@v/v1.2.0.info"
+//
+// The path and version are escaped as by Version.Escaped,
+// which fails if either is invalid.
+func ProxyPath(m Version, ext string) (string, error) {
+	known := false
+	for _, e := range proxyExts {
+		if ext == e {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return "", fmt.Errorf("unknown module proxy file extension %q: must be .info, .mod, or .zip", ext)
+	}
+	path, version, err := m.Escaped()
+	if err != nil {
+		return "", err
+	}
+	return path + "/@v/" + version + ext, nil
+}
+
+// ProxyLatestPath returns the path, relative to the root of a module proxy,
+// of the @latest endpoint for the module with the given path, as in
+// "github.com/!azure/go/@latest". It fails if the module path is invalid.
+func ProxyLatestPath(path string) (string, error) {
+	escaped, err := EscapePath(path)
+	if err != nil {
+		return "", err
+	}
+	return escaped + "/@latest", nil
+}
+
+// Unescaped returns the module version for the escaped path and version,
+// reversing Version.Escaped. It unescapes each half with UnescapePath and
+// UnescapeVersion and then checks the resulting pair with Check.
+func Unescaped(escPath, escVersion string) (Version, error) {
+	path, err := UnescapePath(escPath)
+	if err != nil {
+		return Version{}, err
+	}
+	version, err := UnescapeVersion(escVersion)
+	if err != nil {
+		return Version{}, err
+	}
+	if err := Check(path, version); err != nil {
+		return Version{}, err
+	}
+	return Version{Path: path, Version: version}, nil
+}
+
 // EscapeVersion returns the escaped form of the given module version.
 // Versions are allowed to be in non-semver form but must be valid file names
 // and not contain exclamation marks.
@@ -516,6 +2506,27 @@ func EscapeVersion(v string) (escaped string, err error) {
 	return escapeString(v)
 }
 
+// An EscapeStep describes a single character replaced when escaping a path.
+type EscapeStep struct {
+	Rune        rune   // the original upper-case letter
+	Offset      int    // byte offset of Rune in the unescaped path
+	Replacement string // the escaped form of Rune, such as "!a"
+}
+
+// EscapeTrace returns the replacements EscapePath makes when escaping path,
+// in order of their position in path.
+// It does not check that path is valid.
+// If path needs no escaping, EscapeTrace returns an empty list.
+func EscapeTrace(path string) []EscapeStep {
+	steps := []EscapeStep{}
+	for i, r := range path {
+		if 'A' <= r && r <= 'Z' {
+			steps = append(steps, EscapeStep{Rune: r, Offset: i, Replacement: string([]rune{'!', r + 'a' - 'A'})})
+		}
+	}
+	return steps
+}
+
 func escapeString(s string) (escaped string, err error) {
 	haveUpper := false
 	for _, r := range s {
@@ -557,6 +2568,76 @@ func UnescapePath(escaped string) (path string, err error) {
 	return path, nil
 }
 
+// EscapePathHex returns the hexadecimal escaped form of path, an
+// alternative to EscapePath for storage that is case-insensitive even
+// beyond what the !-for-uppercase convention guarantees, as discussed in
+// the package documentation. Each slash-separated element is replaced by
+// the lower-case hexadecimal encoding of its bytes, keeping the slashes,
+// so that "rsc.io/Quote" becomes "7273632e696f/51756f7465".
+// Unlike EscapePath, EscapePathHex does not check path; callers that
+// need a valid module path should call CheckPath first.
+func EscapePathHex(path string) string {
+	elems := strings.Split(path, "/")
+	for i, elem := range elems {
+		elems[i] = hex.EncodeToString([]byte(elem))
+	}
+	return strings.Join(elems, "/")
+}
+
+// UnescapePathHex returns the path for the hexadecimal escaped path
+// produced by EscapePathHex. It fails if an element of escaped is not
+// an even-length string of lower-case hexadecimal digits: accepting
+// upper case too would give a path more than one escaped form.
+// Like EscapePathHex, it does not check the resulting path.
+func UnescapePathHex(escaped string) (path string, err error) {
+	elems := strings.Split(escaped, "/")
+	for i, elem := range elems {
+		if strings.ToLower(elem) != elem {
+			return "", fmt.Errorf("invalid hex-escaped module path %q: upper-case hexadecimal digit", escaped)
+		}
+		b, err := hex.DecodeString(elem)
+		if err != nil {
+			return "", fmt.Errorf("invalid hex-escaped module path %q: %v", escaped, err)
+		}
+		elems[i] = string(b)
+	}
+	return strings.Join(elems, "/"), nil
+}
+
+// ValidateEscapedPath checks that escaped is the one canonical
+// escaped form of a valid module path: that is, that UnescapePath
+// accepts it and EscapePath maps the result back to escaped.
+// It returns an error describing the first problem found,
+// such as an upper-case letter in the escaped form or a "!"
+// that is not followed by a lower-case letter.
+// Proxy servers can use it to ensure that no two distinct request
+// paths refer to the same module.
+func ValidateEscapedPath(escaped string) error {
+	for i := 0; i < len(escaped); i++ {
+		c := escaped[i]
+		switch {
+		case c >= utf8.RuneSelf:
+			return fmt.Errorf("invalid escaped module path %q: non-ASCII byte at offset %d", escaped, i)
+		case 'A' <= c && c <= 'Z':
+			return fmt.Errorf("invalid escaped module path %q: unescaped upper-case letter %q", escaped, c)
+		case c == '!' && i+1 == len(escaped):
+			return fmt.Errorf("invalid escaped module path %q: trailing !", escaped)
+		case c == '!' && escaped[i+1] == '!':
+			return fmt.Errorf("invalid escaped module path %q: doubled !", escaped)
+		case c == '!' && (escaped[i+1] < 'a' || 'z' < escaped[i+1]):
+			return fmt.Errorf("invalid escaped module path %q: ! followed by %q, not a lower-case letter", escaped, escaped[i+1])
+		}
+	}
+	path, err := UnescapePath(escaped)
+	if err != nil {
+		return err
+	}
+	if reesc, err := EscapePath(path); err != nil || reesc != escaped {
+		return fmt.Errorf("invalid escaped module path %q: not canonical, want %q", escaped, reesc)
+	}
+	return nil
+}
+
 // UnescapeVersion returns the version string for the given escaped version.
 // It fails if the escaped form is invalid or describes an invalid version.
 // Versions are allowed to be in non-semver form but must be valid file names
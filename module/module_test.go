@@ -4,7 +4,14 @@
 
 package module
 
-import "testing"
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
 
 var checkTests = []struct {
 	path    string
@@ -237,6 +244,35 @@ func TestSplitPathVersion(t *testing.T) {
 	}
 }
 
+var pathMajorSuffixTests = []struct {
+	path   string
+	suffix string
+	ok     bool
+}{
+	{"example.com/m", "", true},
+	{"example.com/m/v2", "v2", true},
+	{"example.com/m/v3", "v3", true},
+	{"example.com/m/v1", "", false},
+	{"example.com/m/v02", "", false},
+	{"example.com/m/v2.0", "", false},
+	{"example.com/v", "", true},
+	{"gopkg.in/yaml.v0", "", true},
+	{"gopkg.in/yaml.v1", "", true},
+	{"gopkg.in/yaml.v3", "v3", true},
+	{"gopkg.in/yaml.v2-unstable", "v2", true},
+	{"gopkg.in/yaml.v1-unstable", "", true},
+	{"gopkg.in/yaml", "", false},
+}
+
+func TestPathMajorSuffix(t *testing.T) {
+	for _, tt := range pathMajorSuffixTests {
+		suffix, ok := PathMajorSuffix(tt.path)
+		if suffix != tt.suffix || ok != tt.ok {
+			t.Errorf("PathMajorSuffix(%q) = %q, %v, want %q, %v", tt.path, suffix, ok, tt.suffix, tt.ok)
+		}
+	}
+}
+
 var escapeTests = []struct {
 	path string
 	esc  string // empty means same as path
@@ -317,3 +353,1888 @@ func TestUnescapePath(t *testing.T) {
 		}
 	}
 }
+
+var caseMismatchTests = []struct {
+	required string
+	declared string
+	mismatch bool
+}{
+	{"github.com/user/repo", "github.com/user/repo", false},
+	{"github.com/User/Repo", "github.com/user/repo", true},
+	{"github.com/user/repo", "github.com/USER/REPO", true},
+	{"github.com/user/repo", "github.com/user/other", false},
+	{"", "", false},
+}
+
+func TestCaseMismatch(t *testing.T) {
+	for _, tt := range caseMismatchTests {
+		if got := CaseMismatch(tt.required, tt.declared); got != tt.mismatch {
+			t.Errorf("CaseMismatch(%q, %q) = %v, want %v", tt.required, tt.declared, got, tt.mismatch)
+		}
+	}
+}
+
+func TestVersionsOf(t *testing.T) {
+	list := []Version{
+		{"rsc.io/quote", "v1.5.2"},
+		{"golang.org/x/text", "v0.3.0"},
+		{"rsc.io/quote", "v1.0.0"},
+		{"rsc.io/Quote", "v1.1.0"},
+		{"rsc.io/quote", "v1.5.2/go.mod"},
+	}
+
+	got := strings.Join(VersionsOf(list, "rsc.io/quote"), " ")
+	if want := "v1.0.0 v1.5.2 v1.5.2/go.mod"; got != want {
+		t.Errorf("VersionsOf(list, %q) = %q, want %q", "rsc.io/quote", got, want)
+	}
+	got = strings.Join(VersionsOfFold(list, "rsc.io/quote"), " ")
+	if want := "v1.1.0 v1.0.0 v1.5.2 v1.5.2/go.mod"; got != want {
+		t.Errorf("VersionsOfFold(list, %q) = %q, want %q", "rsc.io/quote", got, want)
+	}
+	if v := VersionsOf(list, "example.com/missing"); v == nil || len(v) != 0 {
+		t.Errorf("VersionsOf(list, %q) = %#v, want empty list", "example.com/missing", v)
+	}
+}
+
+var pathDepthTests = []struct {
+	path     string
+	depth    int
+	isImport bool
+}{
+	{"", 0, false},
+	{"x.y", 1, false},
+	{"golang.org/x/text", 3, false},
+	{"github.com/owner/repo/v2", 4, false},
+	{"github.com/owner/repo/sub/module", 5, false},
+	{"github.com/owner/repo/cmd/tool", 5, true},
+	{"github.com/owner/repo/internal/x/v2", 6, true},
+	{"github.com/owner/cmd", 3, false},
+}
+
+func TestPathDepth(t *testing.T) {
+	for _, tt := range pathDepthTests {
+		if depth := PathDepth(tt.path); depth != tt.depth {
+			t.Errorf("PathDepth(%q) = %d, want %d", tt.path, depth, tt.depth)
+		}
+		if imp := IsLikelyImportNotModule(tt.path); imp != tt.isImport {
+			t.Errorf("IsLikelyImportNotModule(%q) = %v, want %v", tt.path, imp, tt.isImport)
+		}
+	}
+}
+
+var incompatibleFixTests = []struct {
+	path, version string
+	fixPath       string
+	fixVersion    string
+}{
+	{"github.com/x/y", "v2.1.0+incompatible", "github.com/x/y/v2", "v2.1.0"},
+	{"rsc.io/quote", "v17.0.0+incompatible", "rsc.io/quote/v17", "v17.0.0"},
+	{"github.com/x/y", "v1.0.0", "", ""},
+	{"github.com/x/y/v2", "v2.1.0", "", ""},
+	{"github.com/x/y", "v1.0.0+incompatible", "", ""},
+	{"gopkg.in/yaml.v2", "v2.2.1+incompatible", "", ""},
+}
+
+func TestSuggestIncompatibleFix(t *testing.T) {
+	for _, tt := range incompatibleFixTests {
+		path, version, needsFix := SuggestIncompatibleFix(tt.path, tt.version)
+		wantPath, wantVersion, wantFix := tt.fixPath, tt.fixVersion, true
+		if wantPath == "" {
+			wantPath, wantVersion, wantFix = tt.path, tt.version, false
+		}
+		if path != wantPath || version != wantVersion || needsFix != wantFix {
+			t.Errorf("SuggestIncompatibleFix(%q, %q) = %q, %q, %v, want %q, %q, %v", tt.path, tt.version, path, version, needsFix, wantPath, wantVersion, wantFix)
+		}
+	}
+}
+
+func TestCheckPathStream(t *testing.T) {
+	in := "rsc.io/quote\n\n  golang.org/x/text  \nx.y/z/v1\r\nnodot/x\n"
+	want := "ok rsc.io/quote\n" +
+		"ok golang.org/x/text\n" +
+		"error x.y/z/v1: invalid version\n" +
+		"error nodot/x: missing dot in first path element\n"
+	var out strings.Builder
+	if err := CheckPathStream(strings.NewReader(in), &out); err != nil {
+		t.Fatalf("CheckPathStream: %v", err)
+	}
+	if out.String() != want {
+		t.Errorf("CheckPathStream output:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestGopathDir(t *testing.T) {
+	dir, err := GopathDir("github.com/Sirupsen/logrus")
+	if want := filepath.Join("github.com", "Sirupsen", "logrus"); err != nil || dir != want {
+		t.Errorf("GopathDir(%q) = %q, %v, want %q, nil", "github.com/Sirupsen/logrus", dir, err, want)
+	}
+	if dir, err := GopathDir("x.y/z/"); err == nil {
+		t.Errorf("GopathDir(%q) = %q, want error", "x.y/z/", dir)
+	}
+}
+
+func TestIsEmptyVersion(t *testing.T) {
+	for _, v := range []string{"", "none"} {
+		if !IsEmptyVersion(v) {
+			t.Errorf("IsEmptyVersion(%q) = false, want true", v)
+		}
+	}
+	for _, v := range []string{"v0.0.0", "None", "v1.2.3", "latest"} {
+		if IsEmptyVersion(v) {
+			t.Errorf("IsEmptyVersion(%q) = true, want false", v)
+		}
+	}
+}
+
+var compareWithNoneTests = []struct {
+	v, w string
+	cmp  int
+}{
+	{"none", "none", 0},
+	{"none", "v0.0.0", -1},
+	{"v0.0.0-20190101000000-abcdefabcdef", "none", +1},
+	{"none", "", -1},
+	{"", "none", +1},
+	{"none", "bad", -1},
+	{"v1.2.0", "v1.10.0", -1},
+	{"", "", 0},
+}
+
+func TestCompareWithNone(t *testing.T) {
+	for _, tt := range compareWithNoneTests {
+		if cmp := CompareWithNone(tt.v, tt.w); cmp != tt.cmp {
+			t.Errorf("CompareWithNone(%q, %q) = %d, want %d", tt.v, tt.w, cmp, tt.cmp)
+		}
+	}
+}
+
+var fromTagTests = []struct {
+	path    string
+	tag     string
+	version string // empty means error
+}{
+	{"rsc.io/quote", "v1.5.2", "v1.5.2"},
+	{"rsc.io/quote", "1.5.2", "v1.5.2"},
+	{"rsc.io/quote", "v1.5", "v1.5.0"},
+	{"rsc.io/quote", "1", "v1.0.0"},
+	{"rsc.io/quote", "v1.5.2+build", "v1.5.2"},
+	{"rsc.io/quote/v2", "2.0.0-rc.1", "v2.0.0-rc.1"},
+	{"rsc.io/quote", "v2.0.0", ""},
+	{"rsc.io/quote", "release-1", ""},
+	{"rsc.io/quote", "", ""},
+}
+
+func TestFromTag(t *testing.T) {
+	for _, tt := range fromTagTests {
+		m, err := FromTag(tt.path, tt.tag)
+		if tt.version == "" {
+			if err == nil {
+				t.Errorf("FromTag(%q, %q) = %v, want error", tt.path, tt.tag, m)
+			}
+			continue
+		}
+		if want := (Version{tt.path, tt.version}); err != nil || m != want {
+			t.Errorf("FromTag(%q, %q) = %v, %v, want %v, nil", tt.path, tt.tag, m, err, want)
+		}
+	}
+
+	for _, tag := range []string{"release-1", "v2.0.0"} {
+		_, err := FromTag("rsc.io/quote", tag)
+		me, ok := err.(*ModuleError)
+		if !ok {
+			t.Errorf("FromTag(%q, %q) = %v (%T), want *ModuleError", "rsc.io/quote", tag, err, err)
+			continue
+		}
+		if ve, ok := me.Err.(*InvalidVersionError); !ok || ve.Version != tag {
+			t.Errorf("FromTag(%q, %q) = %v, want wrapped *InvalidVersionError for tag", "rsc.io/quote", tag, err)
+		}
+	}
+	want := "rsc.io/quote@v2.0.0: invalid version: should be v0 or v1, not v2"
+	if _, err := FromTag("rsc.io/quote", "v2.0.0"); err == nil || err.Error() != want {
+		t.Errorf("FromTag(%q, %q) = %v, want %q", "rsc.io/quote", "v2.0.0", err, want)
+	}
+	if _, err := FromTag("bad path", "v1.0.0"); err == nil {
+		t.Errorf("FromTag(%q, %q) succeeded, want error", "bad path", "v1.0.0")
+	} else if me, ok := err.(*ModuleError); !ok {
+		t.Errorf("FromTag(%q, %q) = %v (%T), want *ModuleError", "bad path", "v1.0.0", err, err)
+	} else if _, ok := me.Err.(*InvalidPathError); !ok {
+		t.Errorf("FromTag(%q, %q) = %v, want wrapped *InvalidPathError", "bad path", "v1.0.0", err)
+	}
+}
+
+var listsEqualTests = []struct {
+	a, b  []Version
+	equal bool
+}{
+	{nil, nil, true},
+	{nil, []Version{{"x.y/z", "v1.0.0"}}, false},
+	{
+		[]Version{{"x.y/z", "v1.2"}, {"a.b/c", "v0.1.0"}},
+		[]Version{{"a.b/c", "v0.1.0"}, {"x.y/z", "v1.2.0"}, {"a.b/c", "v0.1"}},
+		true,
+	},
+	{
+		[]Version{{"x.y/z", "v2.0.0+incompatible"}},
+		[]Version{{"x.y/z", "v2.0.0"}},
+		false,
+	},
+	{
+		[]Version{{"x.y/z", "v1.0.0"}, {"a.b/c", "v1.0.0"}},
+		[]Version{{"x.y/z", "v1.0.0"}, {"a.b/c", "v1.0.1"}},
+		false,
+	},
+	{
+		[]Version{{"x.y/z", "v1.0.0"}, {"x.y/z", "v1.0.0/go.mod"}},
+		[]Version{{"x.y/z", "v1.0.0/go.mod"}, {"x.y/z", "v1.0.0"}},
+		true,
+	},
+}
+
+func TestListsEqual(t *testing.T) {
+	for _, tt := range listsEqualTests {
+		if eq := ListsEqual(tt.a, tt.b); eq != tt.equal {
+			t.Errorf("ListsEqual(%v, %v) = %v, want %v", tt.a, tt.b, eq, tt.equal)
+		}
+		if eq := ListsEqual(tt.b, tt.a); eq != tt.equal {
+			t.Errorf("ListsEqual(%v, %v) = %v, want %v", tt.b, tt.a, eq, tt.equal)
+		}
+	}
+}
+
+var validateEscapedTests = []struct {
+	escaped string
+	err     string // empty means ok
+}{
+	{"github.com/!google!cloud!platform/omega", ""},
+	{"rsc.io/quote", ""},
+	{"github.com/GoogleCloudPlatform/omega", "unescaped upper-case letter 'G'"},
+	{"github.com/!google!cloud!platform!/omega", "! followed by '/', not a lower-case letter"},
+	{"github.com/!0google/omega", "! followed by '0', not a lower-case letter"},
+	{"github.com/!!google/omega", "doubled !"},
+	{"github.com/google!", "trailing !"},
+	{"github.com/g\xc3\xb6ogle", "non-ASCII byte at offset 12"},
+	{"x.y/z/v1", "invalid version"},
+}
+
+func TestValidateEscapedPath(t *testing.T) {
+	for _, tt := range validateEscapedTests {
+		err := ValidateEscapedPath(tt.escaped)
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("ValidateEscapedPath(%q) = %v, want nil", tt.escaped, err)
+			}
+			continue
+		}
+		if err == nil || !strings.HasSuffix(err.Error(), tt.err) {
+			t.Errorf("ValidateEscapedPath(%q) = %v, want error ending in %q", tt.escaped, err, tt.err)
+		}
+	}
+	for _, tt := range escapeTests {
+		esc, _ := EscapePath(tt.path)
+		if err := ValidateEscapedPath(esc); err != nil {
+			t.Errorf("ValidateEscapedPath(%q) = %v, want nil", esc, err)
+		}
+	}
+}
+
+func TestRequirementsRemovedAdded(t *testing.T) {
+	old := []Version{
+		{"rsc.io/quote", "v1.5.2"},
+		{"rsc.io/sampler", "v1.3.0"},
+		{"golang.org/x/text", "v0.3.0"},
+		{"rsc.io/sampler", "v1.2.0"},
+	}
+	new := []Version{
+		{"rsc.io/quote", "v1.5.3"},
+		{"rsc.io/Quote", "v1.0.0"},
+		{"example.com/m", "v0.1.0"},
+	}
+	removed := fmt.Sprint(RequirementsRemoved(old, new))
+	if want := "[golang.org/x/text@v0.3.0 rsc.io/sampler@v1.2.0 rsc.io/sampler@v1.3.0]"; removed != want {
+		t.Errorf("RequirementsRemoved(old, new) = %s, want %s", removed, want)
+	}
+	added := fmt.Sprint(RequirementsAdded(old, new))
+	if want := "[example.com/m@v0.1.0 rsc.io/Quote@v1.0.0]"; added != want {
+		t.Errorf("RequirementsAdded(old, new) = %s, want %s", added, want)
+	}
+}
+
+func TestAnalyzePath(t *testing.T) {
+	a := AnalyzePath("github.com/Sirupsen/logrus/v2")
+	want := PathAnalysis{
+		Valid:        true,
+		FirstElement: "github.com",
+		HasUppercase: true,
+		EscapedForm:  "github.com/!sirupsen/logrus/v2",
+		PathMajor:    "/v2",
+	}
+	if !reflect.DeepEqual(a, want) {
+		t.Errorf("AnalyzePath(%q) = %+v, want %+v", "github.com/Sirupsen/logrus/v2", a, want)
+	}
+
+	a = AnalyzePath("gopkg.in/yaml.v2")
+	if !a.Valid || !a.IsGopkgIn || a.PathMajor != ".v2" || a.EscapedForm != "gopkg.in/yaml.v2" {
+		t.Errorf("AnalyzePath(%q) = %+v, want valid gopkg.in path with major .v2", "gopkg.in/yaml.v2", a)
+	}
+
+	a = AnalyzePath("Example.com/x")
+	if a.Valid || a.EscapedForm != "" || len(a.Errors) != 1 || a.FirstElement != "Example.com" {
+		t.Errorf("AnalyzePath(%q) = %+v, want invalid path with one error", "Example.com/x", a)
+	}
+}
+
+func TestPathsAtVersion(t *testing.T) {
+	list := []Version{
+		{"rsc.io/sampler", "v1.3.0"},
+		{"golang.org/x/text", "v0.3.0"},
+		{"rsc.io/quote", "v1.3"},
+		{"example.com/m", "v1.3.0"},
+		{"rsc.io/quote", "v1.3.0"},
+		{"rsc.io/quote", "v1.3.0/go.mod"},
+	}
+	got := strings.Join(PathsAtVersion(list, "v1.3.0"), " ")
+	if want := "example.com/m rsc.io/quote rsc.io/sampler"; got != want {
+		t.Errorf("PathsAtVersion(list, %q) = %q, want %q", "v1.3.0", got, want)
+	}
+	got = strings.Join(PathsAtVersion(list, "v1.3.0/go.mod"), " ")
+	if want := "rsc.io/quote"; got != want {
+		t.Errorf("PathsAtVersion(list, %q) = %q, want %q", "v1.3.0/go.mod", got, want)
+	}
+	if p := PathsAtVersion(list, "v2.0.0"); p == nil || len(p) != 0 {
+		t.Errorf("PathsAtVersion(list, %q) = %#v, want empty list", "v2.0.0", p)
+	}
+}
+
+var majorSuffixStyleTests = []struct {
+	path string
+	want string // corrected path; empty means no error
+}{
+	{"gopkg.in/yaml.v2", ""},
+	{"gopkg.in/yaml/v2", "gopkg.in/yaml.v2"},
+	{"gopkg.in/src-d/go-git/v4", "gopkg.in/src-d/go-git.v4"},
+	{"gopkg.in/v2", ""},
+	{"github.com/go-yaml/yaml.v2", "github.com/go-yaml/yaml/v2"},
+	{"github.com/go-check/check.v1", "github.com/go-check/check"},
+	{"github.com/x/y/v2", ""},
+	{"github.com/x/y.v", ""},
+	{"github.com/x/y.v02", ""},
+	{"github.com/x/y", ""},
+	{"x.y", ""},
+}
+
+func TestDetectMajorSuffixStyleError(t *testing.T) {
+	for _, tt := range majorSuffixStyleTests {
+		err := DetectMajorSuffixStyleError(tt.path)
+		if tt.want == "" {
+			if err != nil {
+				t.Errorf("DetectMajorSuffixStyleError(%q) = %v, want nil", tt.path, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("(want %q)", tt.want)) {
+			t.Errorf("DetectMajorSuffixStyleError(%q) = %v, want error suggesting %q", tt.path, err, tt.want)
+		}
+	}
+}
+
+var hostPortTests = []struct {
+	path    string
+	hasPort bool
+	ok      bool // CheckPathAllowPort succeeds
+}{
+	{"localhost:8080/mymod", true, true},
+	{"localhost:8080/mymod/v2", true, true},
+	{"localhost/mymod", false, false},
+	{"-localhost:8080/mymod", true, false},
+	{"local_host:8080/mymod", true, false},
+	{"mods.internal:8080/mymod", true, true},
+	{"mods.internal:8080", true, true},
+	{"mods.internal:8080/mymod/v2", true, true},
+	{"mods.internal:/mymod", false, false},
+	{"mods.internal:http/mymod", false, false},
+	{"mods.internal/x:8080", false, false},
+	{"mods.internal:8080/Bad..path", true, false},
+	{"rsc.io/quote", false, true},
+}
+
+func TestHostPort(t *testing.T) {
+	for _, tt := range hostPortTests {
+		if has := HasHostPort(tt.path); has != tt.hasPort {
+			t.Errorf("HasHostPort(%q) = %v, want %v", tt.path, has, tt.hasPort)
+		}
+		err := CheckPathAllowPort(tt.path)
+		if tt.ok && err != nil {
+			t.Errorf("CheckPathAllowPort(%q) = %v, wanted nil error", tt.path, err)
+		} else if !tt.ok && err == nil {
+			t.Errorf("CheckPathAllowPort(%q) succeeded, wanted error", tt.path)
+		}
+		if tt.hasPort && CheckPath(tt.path) == nil {
+			t.Errorf("CheckPath(%q) succeeded, wanted error", tt.path)
+		}
+	}
+
+	// The example from the CheckPathAllowPort documentation.
+	if err := CheckPathAllowPort("localhost:8080/mymod"); err != nil {
+		t.Errorf("CheckPathAllowPort(%q) = %v, wanted nil error", "localhost:8080/mymod", err)
+	}
+}
+
+func TestDiffString(t *testing.T) {
+	m := Version{"rsc.io/quote", "v1.5"}
+	if s, want := m.DiffString(), "rsc.io/quote v1.5.0"; s != want {
+		t.Errorf("%#v.DiffString() = %q, want %q", m, s, want)
+	}
+	m = Version{"rsc.io/quote", "v17.0.0+incompatible"}
+	if s, want := m.DiffString(), "rsc.io/quote v17.0.0+incompatible"; s != want {
+		t.Errorf("%#v.DiffString() = %q, want %q", m, s, want)
+	}
+
+	for _, s := range []string{"rsc.io/quote v1.5.0", "  rsc.io/quote\tv1.5  "} {
+		m, err := ParseDiffString(s)
+		if want := (Version{"rsc.io/quote", "v1.5.0"}); err != nil || m != want {
+			t.Errorf("ParseDiffString(%q) = %v, %v, want %v, nil", s, m, err, want)
+		}
+	}
+	for _, s := range []string{"", "rsc.io/quote", "rsc.io/quote@v1.5.0", "rsc.io/quote v1.5.0 // indirect", "rsc.io/quote v2.0.0"} {
+		if m, err := ParseDiffString(s); err == nil {
+			t.Errorf("ParseDiffString(%q) = %v, want error", s, m)
+		}
+	}
+}
+
+var denyTests = []struct {
+	path string
+	deny []string
+	ok   bool
+}{
+	{"github.com/x/y", nil, true},
+	{"github.com/x/y", []string{"gitlab.com"}, true},
+	{"github.com/x/y", []string{"github.com"}, false},
+	{"evil.example.com/x", []string{"*.example.com"}, false},
+	{"example.com/x", []string{"*.example.com"}, true},
+	{"github.com/attacker/y", []string{"github.com/attacker"}, false},
+	{"github.com/attacker", []string{"github.com/attacker/y"}, true},
+	{"github.com/x/y", []string{"github.com/x*"}, false},
+	{"github.com/x/y", []string{"[", "gitlab.com"}, true},
+	{"Github.com/x/y", []string{"gitlab.com"}, false},
+}
+
+func TestCheckPathDeny(t *testing.T) {
+	for _, tt := range denyTests {
+		err := CheckPathDeny(tt.path, tt.deny)
+		if tt.ok && err != nil {
+			t.Errorf("CheckPathDeny(%q, %q) = %v, wanted nil error", tt.path, tt.deny, err)
+		} else if !tt.ok && err == nil {
+			t.Errorf("CheckPathDeny(%q, %q) succeeded, wanted error", tt.path, tt.deny)
+		}
+	}
+
+	err := CheckPathDeny("github.com/attacker/x", []string{"github.com/attacker"})
+	de, ok := err.(*DeniedPathError)
+	if !ok || de.Path != "github.com/attacker/x" || de.Pattern != "github.com/attacker" {
+		t.Errorf("CheckPathDeny(denied) = %v (%T), want *DeniedPathError", err, err)
+	}
+	if want := `module path "github.com/attacker/x": denied host (matches "github.com/attacker")`; err == nil || err.Error() != want {
+		t.Errorf("CheckPathDeny(denied) = %v, want %q", err, want)
+	}
+	if err := CheckPathDeny("bad path", []string{"bad path"}); err == nil {
+		t.Errorf("CheckPathDeny(malformed) succeeded, wanted error")
+	} else if _, ok := err.(*InvalidPathError); !ok {
+		t.Errorf("CheckPathDeny(malformed) = %v (%T), want *InvalidPathError", err, err)
+	}
+}
+
+func TestEscapeTrace(t *testing.T) {
+	steps := EscapeTrace("github.com/GoogleCloud/omega")
+	want := []EscapeStep{
+		{'G', 11, "!g"},
+		{'C', 17, "!c"},
+	}
+	if !reflect.DeepEqual(steps, want) {
+		t.Errorf("EscapeTrace(%q) = %v, want %v", "github.com/GoogleCloud/omega", steps, want)
+	}
+	if steps := EscapeTrace("rsc.io/quote"); steps == nil || len(steps) != 0 {
+		t.Errorf("EscapeTrace(%q) = %#v, want empty list", "rsc.io/quote", steps)
+	}
+}
+
+func TestMaxPathElementLength(t *testing.T) {
+	long := strings.Repeat("x", MaxPathElementLength)
+	for _, path := range []string{"x.y/" + long, "x.y/" + long + "/z"} {
+		if err := CheckPath(path); err != nil {
+			t.Errorf("CheckPath(%d-byte element) = %v, want nil", len(long), err)
+		}
+	}
+	long += "x"
+	for _, path := range []string{"x.y/" + long, "x.y/" + long + "/z"} {
+		err := CheckPath(path)
+		if err == nil || !strings.Contains(err.Error(), "too long") {
+			t.Errorf("CheckPath(%d-byte element) = %v, want path element too long error", len(long), err)
+		}
+		if err := CheckFilePath(path); err == nil {
+			t.Errorf("CheckFilePath(%d-byte element) succeeded, want error", len(long))
+		}
+	}
+
+	// Upper-case letters count twice in module paths,
+	// because they are escaped as "!" plus the lower-case letter.
+	// Import and file paths below the module root are stored as is.
+	upper := strings.Repeat("X", 200)
+	for _, path := range []string{"x.y/" + upper, "x.y/" + upper + "/z"} {
+		err := CheckPath(path)
+		if err == nil || !strings.Contains(err.Error(), "too long (400 bytes escaped") {
+			t.Errorf("CheckPath(200 upper-case letters) = %v, want path element too long error", err)
+		}
+		if err := CheckImportPath(path); err != nil {
+			t.Errorf("CheckImportPath(200 upper-case letters) = %v, want nil", err)
+		}
+		if err := CheckFilePath(path); err != nil {
+			t.Errorf("CheckFilePath(200 upper-case letters) = %v, want nil", err)
+		}
+	}
+	half := strings.Repeat("X", MaxPathElementLength/2)
+	if err := CheckPath("x.y/" + half); err != nil {
+		t.Errorf("CheckPath(%d upper-case letters) = %v, want nil", len(half), err)
+	}
+}
+
+func TestGroupByVersion(t *testing.T) {
+	list := []Version{
+		{"k8s.io/client-go", "v0.17.0"},
+		{"k8s.io/api", "v0.17"},
+		{"k8s.io/apimachinery", "v0.17.0"},
+		{"k8s.io/api", "v0.17.0"},
+		{"rsc.io/quote", "v1.5.2"},
+		{"rsc.io/quote", "v1.5.2/go.mod"},
+	}
+	want := map[string][]string{
+		"v0.17.0":       {"k8s.io/api", "k8s.io/apimachinery", "k8s.io/client-go"},
+		"v1.5.2":        {"rsc.io/quote"},
+		"v1.5.2/go.mod": {"rsc.io/quote"},
+	}
+	if groups := GroupByVersion(list); !reflect.DeepEqual(groups, want) {
+		t.Errorf("GroupByVersion(list) = %v, want %v", groups, want)
+	}
+}
+
+func TestCheckNoFoldConflict(t *testing.T) {
+	existing := []string{"rsc.io/quote", "github.com/Sirupsen/logrus"}
+	for _, p := range []string{"rsc.io/quote", "github.com/Sirupsen/logrus", "rsc.io/quote/v2", "golang.org/x/text"} {
+		if err := CheckNoFoldConflict(p, existing); err != nil {
+			t.Errorf("CheckNoFoldConflict(%q, existing) = %v, want nil", p, err)
+		}
+	}
+	for _, p := range []string{"rsc.io/QUOTE", "github.com/sirupsen/logrus"} {
+		if err := CheckNoFoldConflict(p, existing); err == nil {
+			t.Errorf("CheckNoFoldConflict(%q, existing) succeeded, want error", p)
+		}
+	}
+}
+
+var importPathPartsTests = []struct {
+	modulePath string
+	importPath string
+	within     string
+	ok         bool
+}{
+	{"rsc.io/quote", "rsc.io/quote", "", true},
+	{"rsc.io/quote", "rsc.io/quote/buggy", "buggy", true},
+	{"rsc.io/quote", "rsc.io/quote/a/b/c", "a/b/c", true},
+	{"rsc.io/quote/v2", "rsc.io/quote/v2/buggy", "buggy", true},
+	{"rsc.io/quote/v2", "rsc.io/quote/buggy", "", false},
+	{"rsc.io/quote", "rsc.io/quotes", "", false},
+	{"rsc.io/quote", "rsc.io", "", false},
+	{"", "rsc.io/quote", "", false},
+}
+
+func TestImportPathParts(t *testing.T) {
+	for _, tt := range importPathPartsTests {
+		within, ok := ImportPathParts(tt.modulePath, tt.importPath)
+		if within != tt.within || ok != tt.ok {
+			t.Errorf("ImportPathParts(%q, %q) = %q, %v, want %q, %v", tt.modulePath, tt.importPath, within, ok, tt.within, tt.ok)
+		}
+	}
+}
+
+func TestRequiresEscaping(t *testing.T) {
+	for _, tt := range escapeTests {
+		if req := RequiresEscaping(tt.path); req != (tt.esc != "") {
+			t.Errorf("RequiresEscaping(%q) = %v, want %v", tt.path, req, tt.esc != "")
+		}
+	}
+	if !RequiresEscaping("not a Valid path") {
+		t.Errorf("RequiresEscaping(%q) = false, want true", "not a Valid path")
+	}
+}
+
+var parsePathQueryTests = []struct {
+	s     string
+	path  string // empty means error
+	query string
+}{
+	{"example.com/foo/v2@latest", "example.com/foo/v2", "latest"},
+	{"example.com/foo@v1.2.3", "example.com/foo", "v1.2.3"},
+	{"example.com/foo@>=v1.2", "example.com/foo", ">=v1.2"},
+	{"gopkg.in/yaml.v2@v2.2.1", "gopkg.in/yaml.v2", "v2.2.1"},
+	{"example.com/foo/v2", "example.com/foo/v2", ""},
+	{"example.com/foo@", "", ""},
+	{"example.com/foo/v1@latest", "", ""},
+	{"example.com/f@o@latest", "", ""},
+	{"@latest", "", ""},
+}
+
+func TestParsePathQuery(t *testing.T) {
+	for _, tt := range parsePathQueryTests {
+		path, query, err := ParsePathQuery(tt.s)
+		if tt.path == "" {
+			if err == nil {
+				t.Errorf("ParsePathQuery(%q) = %q, %q, want error", tt.s, path, query)
+			}
+			continue
+		}
+		if path != tt.path || query != tt.query || err != nil {
+			t.Errorf("ParsePathQuery(%q) = %q, %q, %v, want %q, %q, nil", tt.s, path, query, err, tt.path, tt.query)
+		}
+	}
+}
+
+var stripURLSchemeTests = []struct {
+	in, out string
+}{
+	{"https://github.com/user/repo", "github.com/user/repo"},
+	{"http://github.com/user/repo.git", "github.com/user/repo"},
+	{"git+ssh://github.com/user/repo.git", "github.com/user/repo"},
+	{"ssh://example.com/repo", "example.com/repo"},
+	{"github.com/user/repo.git", "github.com/user/repo"},
+	{"github.com/user/repo", "github.com/user/repo"},
+	{"ftp://example.com/repo", "ftp://example.com/repo"},
+	{"https://https://example.com/repo", "https://example.com/repo"},
+}
+
+func TestStripURLScheme(t *testing.T) {
+	for _, tt := range stripURLSchemeTests {
+		if out := StripURLScheme(tt.in); out != tt.out {
+			t.Errorf("StripURLScheme(%q) = %q, want %q", tt.in, out, tt.out)
+		}
+	}
+}
+
+func TestSortRequires(t *testing.T) {
+	list := []Version{
+		{"rsc.io/sampler", "v1.3.0"},
+		{"golang.org/x/text", "v0.3.0"},
+		{"rsc.io/quote", "v1.10.0"},
+		{"rsc.io/quote", "v1.5.2"},
+		{"golang.org/x/text", "v0.3"},
+	}
+	SortRequires(list)
+	got := fmt.Sprint(list)
+	if want := "[golang.org/x/text@v0.3.0 golang.org/x/text@v0.3 rsc.io/quote@v1.5.2 rsc.io/quote@v1.10.0 rsc.io/sampler@v1.3.0]"; got != want {
+		t.Errorf("SortRequires:\nhave %s\nwant %s", got, want)
+	}
+}
+
+var trimGitSuffixTests = []struct {
+	in, out string
+}{
+	{"github.com/user/repo.git", "github.com/user/repo"},
+	{"github.com/user/repo.git.git", "github.com/user/repo.git"},
+	{"example.git", "example"},
+	{"github.com/user/repo", "github.com/user/repo"},
+	{"github.com/user/repo.gitx", "github.com/user/repo.gitx"},
+	{"github.com/user/.git", "github.com/user/.git"},
+	{"github.com/user/repo..git", "github.com/user/repo..git"},
+	{".git", ".git"},
+}
+
+func TestTrimGitSuffix(t *testing.T) {
+	for _, tt := range trimGitSuffixTests {
+		if out := TrimGitSuffix(tt.in); out != tt.out {
+			t.Errorf("TrimGitSuffix(%q) = %q, want %q", tt.in, out, tt.out)
+		}
+	}
+}
+
+var majorVersionDirTests = []struct {
+	name  string
+	major int
+	ok    bool
+}{
+	{"v2", 2, true},
+	{"v10", 10, true},
+	{"v0", 0, false},
+	{"v1", 0, false},
+	{"v01", 0, false},
+	{"v2.3", 0, false},
+	{"v", 0, false},
+	{"2", 0, false},
+	{"V2", 0, false},
+	{"x/v2", 0, false},
+	{"v99999999999999999999", 0, false},
+}
+
+func TestIsMajorVersionDir(t *testing.T) {
+	for _, tt := range majorVersionDirTests {
+		major, ok := IsMajorVersionDir(tt.name)
+		if major != tt.major || ok != tt.ok {
+			t.Errorf("IsMajorVersionDir(%q) = %d, %v, want %d, %v", tt.name, major, ok, tt.major, tt.ok)
+		}
+	}
+}
+
+func TestIsMinimal(t *testing.T) {
+	// A 1.0.0 requires B 1.1.0 and C 1.0.0; C 1.0.0 requires B 1.2.0.
+	// F 1.0.0 requires its main module, cycle.x, back.
+	graph := map[Version][]Version{
+		{"main.x", ""}:         {{"b.x", "v1.1.0"}, {"c.x", "v1.0.0"}},
+		{"b.x", "v1.1.0"}:      {},
+		{"b.x", "v1.2.0"}:      {{"c.x", "none"}},
+		{"b.x", "v1.3.0"}:      {},
+		{"c.x", "v1.0.0"}:      {{"b.x", "v1.2.0"}},
+		{"d.x", "v1.0.0"}:      {{"e.x", "v1.0.0"}},
+		{"e.x", "v1.0.0"}:      {{"d.x", "v1.0.0"}},
+		{"broken.x", "v1.0.0"}: nil,
+		{"cycle.x", ""}:        {{"f.x", "v1.0.0"}},
+		{"f.x", "v1.0.0"}:      {{"cycle.x", "v0.1.0"}},
+	}
+	reqs := func(m Version) ([]Version, error) {
+		list, ok := graph[m]
+		if !ok || list == nil {
+			return nil, fmt.Errorf("no go.mod for %v", m)
+		}
+		return list, nil
+	}
+
+	isMinimalTests := []struct {
+		list []Version
+		err  string // empty means minimal
+	}{
+		{[]Version{{"main.x", ""}, {"b.x", "v1.2.0"}, {"c.x", "v1.0.0"}}, ""},
+		{[]Version{{"main.x", ""}, {"c.x", "v1.0.0"}, {"b.x", "v1.2.0"}}, ""},
+		{[]Version{{"main.x", ""}, {"b.x", "v1.1.0"}, {"c.x", "v1.0.0"}}, "c.x@v1.0.0 requires b.x@v1.2.0, but build list has b.x@v1.1.0"},
+		{[]Version{{"main.x", ""}, {"b.x", "v1.3.0"}, {"c.x", "v1.0.0"}}, "build list has b.x@v1.3.0, but highest requirement is v1.2.0"},
+		{[]Version{{"main.x", ""}, {"b.x", "v1.2.0"}}, "main.x@ requires c.x@v1.0.0, missing from build list"},
+		{[]Version{{"main.x", ""}, {"b.x", "v1.2.0"}, {"c.x", "v1.0.0"}, {"d.x", "v1.0.0"}, {"e.x", "v1.0.0"}}, "d.x@v1.0.0 is not required by any module in the build list"},
+		{[]Version{{"main.x", ""}, {"b.x", "v1.2.0"}, {"c.x", "v1.0.0"}, {"b.x", "v1.2.0"}}, "build list contains both b.x@v1.2.0 and b.x@v1.2.0"},
+		{[]Version{{"cycle.x", ""}, {"f.x", "v1.0.0"}}, ""},
+		{[]Version{{"broken.x", "v1.0.0"}}, "no go.mod for broken.x@v1.0.0"},
+		{nil, "empty build list"},
+	}
+	for _, tt := range isMinimalTests {
+		ok, err := IsMinimal(tt.list, reqs)
+		if tt.err == "" {
+			if !ok || err != nil {
+				t.Errorf("IsMinimal(%v) = %v, %v, want true, nil", tt.list, ok, err)
+			}
+			continue
+		}
+		if ok || err == nil || err.Error() != tt.err {
+			t.Errorf("IsMinimal(%v) = %v, %v, want false, %q", tt.list, ok, err, tt.err)
+		}
+	}
+}
+
+var escapeQueryTests = []struct {
+	path string
+	esc  string
+}{
+	{"github.com/GoogleCloudPlatform/omega", "github.com/GoogleCloudPlatform/omega"},
+	{"x.y/c++/v2", "x.y/c%2B%2B/v2"},
+	{"ascii.com/abcdefghijklmnopqrstuvwxyz.-+/~_0123456789", "ascii.com/abcdefghijklmnopqrstuvwxyz.-%2B/~_0123456789"},
+}
+
+func TestEscapePathQuery(t *testing.T) {
+	for _, tt := range escapeQueryTests {
+		esc, err := EscapePathQuery(tt.path)
+		if err != nil || esc != tt.esc {
+			t.Errorf("EscapePathQuery(%q) = %q, %v, want %q, nil", tt.path, esc, err, tt.esc)
+		}
+		path, err := UnescapePathQuery(esc)
+		if err != nil || path != tt.path {
+			t.Errorf("UnescapePathQuery(%q) = %q, %v, want %q, nil", esc, path, err, tt.path)
+		}
+		q := url.Values{"mod": {tt.path}}.Encode()
+		if path, err := UnescapePathQuery(strings.TrimPrefix(q, "mod=")); err != nil || path != tt.path {
+			t.Errorf("UnescapePathQuery(%q) = %q, %v, want %q, nil", q, path, err, tt.path)
+		}
+	}
+	for _, tt := range checkPathTests {
+		if !tt.ok {
+			if esc, err := EscapePathQuery(tt.path); err == nil {
+				t.Errorf("EscapePathQuery(%q) = %q, want error (invalid path)", tt.path, esc)
+			}
+		}
+	}
+	for _, bad := range []string{"x.y/c+", "x.y/%zz", "x.y/a%20b"} {
+		if path, err := UnescapePathQuery(bad); err == nil {
+			t.Errorf("UnescapePathQuery(%q) = %q, want error", bad, path)
+		}
+	}
+}
+
+func TestHosts(t *testing.T) {
+	list := []Version{
+		{"rsc.io/quote", "v1.5.2"},
+		{"gopkg.in/yaml.v2", "v2.2.1"},
+		{"github.com/x/y", "v1.0.0"},
+		{"rsc.io/sampler", "v1.3.0"},
+		{"github.com/x/z", "v1.0.0"},
+		{"Bad.Host/x", "v1.0.0"},
+		{"nodot/x", "v1.0.0"},
+		{"/x", "v1.0.0"},
+	}
+	got := strings.Join(Hosts(list), " ")
+	if want := "github.com gopkg.in rsc.io"; got != want {
+		t.Errorf("Hosts(list) = %q, want %q", got, want)
+	}
+	if h := Hosts(nil); h == nil || len(h) != 0 {
+		t.Errorf("Hosts(nil) = %#v, want empty list", h)
+	}
+}
+
+var suspiciousVersionTests = []struct {
+	v      string
+	reason string // empty means not suspicious
+}{
+	{"v1.2.3", ""},
+	{"v2.0.0+incompatible", ""},
+	{"v0.0.0-20191109021931-daa7c04131f5", ""},
+	{"v0.0.1", ""},
+	{"v12345.0.0", ""},
+	{"v0.0.0", "v0.0.0 is rarely a deliberate release"},
+	{"v0.0", "v0.0.0 is rarely a deliberate release"},
+	{"v20190101.0.0", "major version 20190101 is implausibly large"},
+	{"v1.2.123456-rc.1", "patch version 123456 is implausibly large"},
+	{"v1.0.0+incompatible", "+incompatible is meaningless on a v1 version"},
+	{"v0.3.0+incompatible", "+incompatible is meaningless on a v0 version"},
+	{"1.2.3", "not a semantic version"},
+	{"latest", "not a semantic version"},
+}
+
+func TestSuspiciousVersion(t *testing.T) {
+	for _, tt := range suspiciousVersionTests {
+		reason, suspicious := SuspiciousVersion(tt.v)
+		if reason != tt.reason || suspicious != (tt.reason != "") {
+			t.Errorf("SuspiciousVersion(%q) = %q, %v, want %q, %v", tt.v, reason, suspicious, tt.reason, tt.reason != "")
+		}
+	}
+}
+
+func TestClassifyPathError(t *testing.T) {
+	for _, tt := range checkPathTests {
+		retriable, err := ClassifyPathError(tt.path)
+		if retriable != tt.ok || (err == nil) != tt.ok {
+			t.Errorf("ClassifyPathError(%q) = %v, %v, want retriable %v", tt.path, retriable, err, tt.ok)
+		}
+	}
+}
+
+var legacyGopkgInPseudoTests = []struct {
+	path, version string
+	ok            bool
+}{
+	{"gopkg.in/check.v1", "v0.0.0-20161208181325-20d25e280405", true},
+	{"gopkg.in/check.v1-unstable", "v0.0.0-20161208181325-20d25e280405", true},
+	{"gopkg.in/check.v1", "v1.0.0-20161208181325-20d25e280405", false},
+	{"gopkg.in/check.v1", "v0.0.0", false},
+	{"gopkg.in/check.v2", "v0.0.0-20161208181325-20d25e280405", false},
+	{"gopkg.in/check.v0", "v0.0.0-20161208181325-20d25e280405", false},
+	{"github.com/go-check/check", "v0.0.0-20161208181325-20d25e280405", false},
+	{"gopkg.in/check.v1", "v0.0.0-bad!", false},
+}
+
+func TestIsLegacyGopkgInPseudo(t *testing.T) {
+	for _, tt := range legacyGopkgInPseudoTests {
+		if ok := IsLegacyGopkgInPseudo(tt.path, tt.version); ok != tt.ok {
+			t.Errorf("IsLegacyGopkgInPseudo(%q, %q) = %v, want %v", tt.path, tt.version, ok, tt.ok)
+		}
+	}
+}
+
+func TestClassify(t *testing.T) {
+	for _, tt := range checkPathTests {
+		want := "invalid"
+		if tt.ok {
+			want = "module"
+		} else if tt.importOK {
+			want = "import"
+		}
+		if kind := Classify(tt.path); kind != want {
+			t.Errorf("Classify(%q) = %q, want %q", tt.path, kind, want)
+		}
+	}
+	if kind := Classify("net/http"); kind != "import" {
+		t.Errorf("Classify(%q) = %q, want %q", "net/http", kind, "import")
+	}
+}
+
+func TestMergeLists(t *testing.T) {
+	a := []Version{
+		{"rsc.io/quote", "v1.5.2"},
+		{"rsc.io/sampler", "v1.3"},
+		{"rsc.io/quote", "v1.5.2/go.mod"},
+		{"github.com/x/y", "v2.0.0+incompatible"},
+	}
+	b := []Version{
+		{"rsc.io/sampler", "v1.3.0"},
+		{"rsc.io/quote", "v1.4.0"},
+		{"golang.org/x/text", "v0.3.0"},
+		{"rsc.io/quote", "v1.6.0/go.mod"},
+		{"github.com/x/y", "v2.1.0+incompatible"},
+		{"rsc.io/quote", "v1.5.2"},
+	}
+	got := fmt.Sprint(MergeLists(a, b))
+	want := "[github.com/x/y@v2.1.0+incompatible golang.org/x/text@v0.3.0 rsc.io/quote@v1.5.2 rsc.io/quote@v1.6.0/go.mod rsc.io/sampler@v1.3]"
+	if got != want {
+		t.Errorf("MergeLists(a, b):\nhave %s\nwant %s", got, want)
+	}
+	if m := MergeLists(nil, nil); len(m) != 0 {
+		t.Errorf("MergeLists(nil, nil) = %v, want empty list", m)
+	}
+}
+
+var checkExcludeTests = []struct {
+	path, version string
+	ok            bool
+}{
+	{"rsc.io/quote", "v1.5.2", true},
+	{"rsc.io/quote", "v17.0.0+incompatible", true},
+	{"rsc.io/quote", "v0.0.0-20191109021931-daa7c04131f5", true},
+	{"rsc.io/quote", "v1.5", false},
+	{"rsc.io/quote", "v1.5.2+meta", false},
+	{"rsc.io/quote", "latest", false},
+	{"rsc.io/quote", ">v1.5.2", false},
+	{"rsc.io/quote", "v2.0.0", false},
+	{"rsc.io/quote/v2", "v2.0.0", true},
+	{"bad path", "v1.0.0", false},
+}
+
+func TestCheckExclude(t *testing.T) {
+	for _, tt := range checkExcludeTests {
+		err := CheckExclude(tt.path, tt.version)
+		if tt.ok && err != nil {
+			t.Errorf("CheckExclude(%q, %q) = %v, wanted nil error", tt.path, tt.version, err)
+		} else if !tt.ok && err == nil {
+			t.Errorf("CheckExclude(%q, %q) succeeded, wanted error", tt.path, tt.version)
+		}
+	}
+}
+
+var enclosingModuleTests = []struct {
+	importPath string
+	mod        string // empty means not found
+}{
+	{"example.com/repo", "example.com/repo"},
+	{"example.com/repo/pkg", "example.com/repo"},
+	{"example.com/repo/sub", "example.com/repo/sub"},
+	{"example.com/repo/sub/pkg", "example.com/repo/sub"},
+	{"example.com/repo/subx", "example.com/repo"},
+	{"example.com/repo/v2", "example.com/repo/v2"},
+	{"example.com/repo/v2/pkg", "example.com/repo/v2"},
+	{"example.com/repo/v3/pkg", ""},
+	{"example.com/repo/v1/pkg", "example.com/repo"},
+	{"example.com/other", ""},
+	{"gopkg.in/yaml.v2/pkg", "gopkg.in/yaml.v2"},
+}
+
+func TestEnclosingModule(t *testing.T) {
+	decls := []string{
+		"example.com/repo/sub",
+		"example.com/repo",
+		"example.com/repo/v2",
+		"gopkg.in/yaml.v2",
+	}
+	for _, tt := range enclosingModuleTests {
+		mod, ok := EnclosingModule(tt.importPath, decls)
+		if mod != tt.mod || ok != (tt.mod != "") {
+			t.Errorf("EnclosingModule(%q, decls) = %q, %v, want %q, %v", tt.importPath, mod, ok, tt.mod, tt.mod != "")
+		}
+	}
+}
+
+var shadowsStdlibTests = []struct {
+	path    string
+	shadows bool
+}{
+	{"example.com/x/http", true},
+	{"github.com/user/json", true},
+	{"github.com/user/context/v2", true},
+	{"github.com/user/httpx", false},
+	{"github.com/user/http/client", false},
+	{"net/http", false},
+	{"encoding/json", false},
+	{"context", false},
+	{"fmt.example.com", false},
+}
+
+func TestShadowsStdlib(t *testing.T) {
+	for _, tt := range shadowsStdlibTests {
+		if shadows := ShadowsStdlib(tt.path); shadows != tt.shadows {
+			t.Errorf("ShadowsStdlib(%q) = %v, want %v", tt.path, shadows, tt.shadows)
+		}
+	}
+}
+
+func TestEscapedRoundTrip(t *testing.T) {
+	m := Version{"github.com/GoogleCloudPlatform/omega", "v1.2.3-RC.1"}
+	path, version, err := m.Escaped()
+	if err != nil || path != "github.com/!google!cloud!platform/omega" || version != "v1.2.3-!r!c.1" {
+		t.Fatalf("%v.Escaped() = %q, %q, %v, want %q, %q, nil", m, path, version, err, "github.com/!google!cloud!platform/omega", "v1.2.3-!r!c.1")
+	}
+	back, err := Unescaped(path, version)
+	if err != nil || back != m {
+		t.Errorf("Unescaped(%q, %q) = %v, %v, want %v, nil", path, version, back, err, m)
+	}
+
+	if _, _, err := (Version{"x.y/z", "v1.0.0!"}).Escaped(); err == nil {
+		t.Errorf("Escaped succeeded for version with !, want error")
+	}
+	if m, err := Unescaped("x.y/z/v2", "v1.0.0"); err == nil {
+		t.Errorf("Unescaped(%q, %q) = %v, want error (mismatched major)", "x.y/z/v2", "v1.0.0", m)
+	}
+}
+
+func TestFilterRetracted(t *testing.T) {
+	versions := []string{"v1.0.0", "v1.0.1", "v1.1.0-rc.1", "v1.1.0", "v1.1.5", "v1.2.0", "v1.2.1", "bad"}
+	kept, retracted, err := FilterRetracted(versions, []string{"v1.0.1", "[v1.1.0, v1.2.0]"})
+	if err != nil {
+		t.Fatalf("FilterRetracted: %v", err)
+	}
+	if got, want := strings.Join(kept, " "), "v1.0.0 v1.1.0-rc.1 v1.2.1 bad"; got != want {
+		t.Errorf("FilterRetracted kept %q, want %q", got, want)
+	}
+	if got, want := strings.Join(retracted, " "), "v1.0.1 v1.1.0 v1.1.5 v1.2.0"; got != want {
+		t.Errorf("FilterRetracted retracted %q, want %q", got, want)
+	}
+
+	for _, bad := range []string{"latest", "[v1.0.0]", "[v1.2.0, v1.0.0]", "[v1.0.0, x]", "v1.0.0, v1.1.0"} {
+		if _, _, err := FilterRetracted(versions, []string{"v1.0.0", bad}); err == nil || !strings.Contains(err.Error(), fmt.Sprintf("%q", bad)) {
+			t.Errorf("FilterRetracted(versions, %q) = %v, want error naming interval", bad, err)
+		}
+	}
+}
+
+var normalizeRequireTests = []struct {
+	path, version string
+	indirect      bool
+	out           Version
+	err           string
+}{
+	{"x.y/z", "v1.2.3", false, Version{"x.y/z", "v1.2.3"}, ""},
+	{"x.y/z", "v1.2", true, Version{"x.y/z", "v1.2.0"}, ""},
+	{"x.y/z", "v1.2.3+meta", false, Version{"x.y/z", "v1.2.3"}, ""},
+	{"x.y/z", "v2.0.0+incompatible", true, Version{"x.y/z", "v2.0.0+incompatible"}, ""},
+	{"x.y/z/v2", "v2", false, Version{"x.y/z/v2", "v2.0.0"}, ""},
+	{"x.y/z", "latest", false, Version{}, `invalid require x.y/z@latest: malformed semantic version`},
+	{"x.y/z", "v2.0.0", false, Version{}, `invalid require x.y/z@v2.0.0: mismatched module path x.y/z and version v2.0.0 (want v0 or v1)`},
+	{"x.y/z/v2", "v1", false, Version{}, `invalid require x.y/z/v2@v1: mismatched module path x.y/z/v2 and version v1.0.0 (want /v2)`},
+	{"bad path", "v1.0.0", false, Version{}, `invalid require bad path@v1.0.0: malformed module path "bad path": invalid char ' '`},
+}
+
+func TestNormalizeRequire(t *testing.T) {
+	for _, tt := range normalizeRequireTests {
+		out, indirect, err := NormalizeRequire(tt.path, tt.version, tt.indirect)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("NormalizeRequire(%q, %q) error = %v, want %q", tt.path, tt.version, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || out != tt.out || indirect != tt.indirect {
+			t.Errorf("NormalizeRequire(%q, %q, %v) = %v, %v, %v, want %v, %v, nil", tt.path, tt.version, tt.indirect, out, indirect, err, tt.out, tt.indirect)
+		}
+	}
+}
+
+var repoRootTests = []struct {
+	path, root string
+	err        string
+}{
+	{"github.com/user/repo", "github.com/user/repo", ""},
+	{"github.com/user/repo/v2", "github.com/user/repo", ""},
+	{"github.com/user/repo/submod/v2", "github.com/user/repo", ""},
+	{"gitlab.com/group/proj/pkg", "gitlab.com/group/proj", ""},
+	{"bitbucket.org/user/repo", "bitbucket.org/user/repo", ""},
+	{"gopkg.in/yaml.v2", "gopkg.in/yaml.v2", ""},
+	{"gopkg.in/yaml.v2/sub", "gopkg.in/yaml.v2", ""},
+	{"gopkg.in/user/pkg.v3", "gopkg.in/user/pkg.v3", ""},
+	{"gopkg.in/user/pkg.v3/sub", "gopkg.in/user/pkg.v3", ""},
+	{"example.com/repo.git/sub/v2", "example.com/repo.git", ""},
+	{"example.com/a/b.hg", "example.com/a/b.hg", ""},
+	{"github.com/user", "", `malformed module path "github.com/user": github.com paths must have the form github.com/user/repo`},
+	{"gopkg.in/yaml", "", `malformed module path "gopkg.in/yaml": gopkg.in paths must have the form gopkg.in/pkg.vN or gopkg.in/user/pkg.vN`},
+	{"example.com/repo", "", `cannot determine repository root for "example.com/repo": unrecognized host example.com`},
+	{"example.com/git/hg", "", `cannot determine repository root for "example.com/git/hg": unrecognized host example.com`},
+	{"bad path", "", `malformed import path "bad path": invalid char ' '`},
+}
+
+func TestRepoRoot(t *testing.T) {
+	for _, tt := range repoRootTests {
+		root, err := RepoRoot(tt.path)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("RepoRoot(%q) = %q, %v, want error %q", tt.path, root, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || root != tt.root {
+			t.Errorf("RepoRoot(%q) = %q, %v, want %q, nil", tt.path, root, err, tt.root)
+		}
+	}
+}
+
+var importCommentTests = []struct {
+	comment, path string
+	err           string
+}{
+	{`import "rsc.io/quote"`, "rsc.io/quote", ""},
+	{`// import "rsc.io/quote"`, "rsc.io/quote", ""},
+	{"  //\timport\t\"rsc.io/quote/v3\"  ", "rsc.io/quote/v3", ""},
+	{`/* import "rsc.io/quote" */`, "rsc.io/quote", ""},
+	{`importx "rsc.io/quote"`, "", `malformed import comment "importx \"rsc.io/quote\"": want import "path"`},
+	{`// import`, "", `malformed import comment "// import": want import "path"`},
+	{"import `rsc.io/quote`", "", "malformed import comment \"import `rsc.io/quote`\": path must be a double-quoted string"},
+	{`import "rsc.io/quote" extra`, "", `malformed import comment "import \"rsc.io/quote\" extra": invalid quoted path`},
+	{`import "bad path"`, "", `malformed import path "bad path": invalid char ' '`},
+}
+
+func TestCheckImportComment(t *testing.T) {
+	for _, tt := range importCommentTests {
+		path, err := CheckImportComment(tt.comment)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("CheckImportComment(%q) = %q, %v, want error %q", tt.comment, path, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || path != tt.path {
+			t.Errorf("CheckImportComment(%q) = %q, %v, want %q, nil", tt.comment, path, err, tt.path)
+		}
+	}
+}
+
+func TestFindEquivalentDuplicates(t *testing.T) {
+	list := []Version{
+		{"github.com/user/repo", "v1.0.0"},
+		{"rsc.io/quote", "v1.5.2"},
+		{"github.com/User/Repo", "v1.1.0"},
+		{"gopkg.in/yaml.v2", "v2.2.1"},
+		{"rsc.io/quote/v3", "v3.1.0"},
+		{"gopkg.in/yaml/v2", "v2.2.1"},
+		{"example.com/m/v1", "v1.0.0"},
+		{"example.com/m.git", "v1.0.0"},
+		{"example.com/m", "v1.0.0"},
+		{"rsc.io/sampler", "v1.3.0"},
+	}
+	var got []string
+	for _, g := range FindEquivalentDuplicates(list) {
+		var s []string
+		for _, m := range g {
+			s = append(s, m.String())
+		}
+		got = append(got, strings.Join(s, " "))
+	}
+	want := []string{
+		"example.com/m@v1.0.0 example.com/m.git@v1.0.0 example.com/m/v1@v1.0.0",
+		"github.com/User/Repo@v1.1.0 github.com/user/repo@v1.0.0",
+		"gopkg.in/yaml.v2@v2.2.1 gopkg.in/yaml/v2@v2.2.1",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("FindEquivalentDuplicates:\nhave:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+var vanityMetaTests = []struct {
+	prefix, vcs, root string
+	err               string
+}{
+	{"rsc.io/quote", "git", "https://github.com/rsc/quote", ""},
+	{"example.com/m", "hg", "ssh://hg@example.com/m", ""},
+	{"example.com/m", "mod", "https://proxy.example.com", ""},
+	{"bad path", "git", "https://github.com/rsc/quote", `invalid go-import import prefix: malformed module path "bad path": invalid char ' '`},
+	{"rsc.io/quote", "cvs", "https://github.com/rsc/quote", `invalid go-import vcs "cvs": must be one of bzr, git, hg, mod, svn`},
+	{"rsc.io/quote", "git", "github.com/rsc/quote", `invalid go-import repo root "github.com/rsc/quote": must be a URL such as https://host/path`},
+	{"rsc.io/quote", "git", "file:///tmp/quote", `invalid go-import repo root "file:///tmp/quote": must be a URL such as https://host/path`},
+	{"rsc.io/quote", "git", "https://", `invalid go-import repo root "https://": must be a URL such as https://host/path`},
+	{"example.com/m", "mod", "ssh://proxy.example.com", `invalid go-import repo root "ssh://proxy.example.com": module proxy URL must use https or http`},
+}
+
+func TestCheckVanityMeta(t *testing.T) {
+	for _, tt := range vanityMetaTests {
+		err := CheckVanityMeta(tt.prefix, tt.vcs, tt.root)
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("CheckVanityMeta(%q, %q, %q): %v", tt.prefix, tt.vcs, tt.root, err)
+			}
+		} else if err == nil || err.Error() != tt.err {
+			t.Errorf("CheckVanityMeta(%q, %q, %q) = %v, want %q", tt.prefix, tt.vcs, tt.root, err, tt.err)
+		}
+	}
+}
+
+var versionMatchesTests = []struct {
+	pattern, v string
+	ok         bool
+}{
+	{"", "v1.2.3", true},
+	{"", "anything", true},
+	{"v1", "v1.0.0", true},
+	{"v1", "v1.9.9", true},
+	{"v1", "v2.0.0", false},
+	{"v1", "v1.0.0-rc.1", false},
+	{"v2", "v2.3.0+incompatible", true},
+	{"v1.2", "v1.2.5", true},
+	{"v1.2", "v1.20.0", false},
+	{"v1.2", "v1.2.5-pre", false},
+	{"v1.2.3", "v1.2.3", true},
+	{"v1.2.3", "v1.2.3+meta", true},
+	{"v1.2.3", "v1.2.4", false},
+	{"v1.2.3-rc.1", "v1.2.3-rc.1", true},
+	{"v1.2.3-rc.1", "v1.2.3", false},
+	{"v1.2.3", "bad", false},
+	{"latest", "v1.2.3", false},
+}
+
+func TestVersionMatches(t *testing.T) {
+	for _, tt := range versionMatchesTests {
+		if ok := VersionMatches(tt.pattern, tt.v); ok != tt.ok {
+			t.Errorf("VersionMatches(%q, %q) = %v, want %v", tt.pattern, tt.v, ok, tt.ok)
+		}
+	}
+}
+
+var pathFromRepoTests = []struct {
+	root, subdir string
+	major        int
+	path         string
+	err          string
+}{
+	{"github.com/user/repo", "", 0, "github.com/user/repo", ""},
+	{"github.com/user/repo", "", 1, "github.com/user/repo", ""},
+	{"github.com/user/repo", "", 2, "github.com/user/repo/v2", ""},
+	{"github.com/user/repo", "submod", 2, "github.com/user/repo/submod/v2", ""},
+	{"github.com/user/repo", "a/b", 1, "github.com/user/repo/a/b", ""},
+	{"gopkg.in/yaml.v2", "", 3, "gopkg.in/yaml.v3", ""},
+	{"gopkg.in/yaml", "", 1, "gopkg.in/yaml.v1", ""},
+	{"gopkg.in/user/pkg.v1", "", 0, "gopkg.in/user/pkg.v0", ""},
+	{"github.com/user/repo", "", -1, "", `invalid major version -1`},
+	{"bad path", "", 1, "", `malformed module path "bad path": invalid char ' '`},
+	{"github.com/user/repo", "a//b", 1, "", `malformed module path "github.com/user/repo/a//b": double slash`},
+	{"github.com/user/repo", "v3", 1, "", `malformed module path "github.com/user/repo/v3": subdirectory "v3" looks like a major version suffix`},
+	{"gopkg.in/yaml.v2", "sub", 2, "", `malformed module path "gopkg.in/yaml.v2": gopkg.in modules cannot be in a subdirectory (sub)`},
+}
+
+func TestPathFromRepo(t *testing.T) {
+	for _, tt := range pathFromRepoTests {
+		path, err := PathFromRepo(tt.root, tt.subdir, tt.major)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("PathFromRepo(%q, %q, %d) = %q, %v, want error %q", tt.root, tt.subdir, tt.major, path, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || path != tt.path {
+			t.Errorf("PathFromRepo(%q, %q, %d) = %q, %v, want %q, nil", tt.root, tt.subdir, tt.major, path, err, tt.path)
+		}
+	}
+}
+
+var modulePathConsistencyTests = []struct {
+	line, root, dir string
+	err             string
+}{
+	{"github.com/user/repo", "github.com/user/repo", "", ""},
+	{"module github.com/user/repo/v2", "github.com/user/repo", ".", ""},
+	{`module "github.com/user/repo/sub"`, "github.com/user/repo", "sub", ""},
+	{"github.com/user/repo/sub/v3", "github.com/user/repo", "sub/", ""},
+	{"github.com/user/repo/v2", "github.com/user/repo", "v2", ""},
+	{"github.com/user/repo/a/b", "github.com/user/repo", "a/b", ""},
+	{"gopkg.in/yaml.v2", "gopkg.in/yaml.v2", "", ""},
+	{"github.com/user/repo", "github.com/user/repo", "sub", `module path "github.com/user/repo" declared in sub/go.mod does not match its location in the repository: want "github.com/user/repo/sub", optionally followed by a major version suffix`},
+	{"github.com/user/other", "github.com/user/repo", "", `module path "github.com/user/other" declared in go.mod does not match its location in the repository: want "github.com/user/repo", optionally followed by a major version suffix`},
+	{"github.com/user/repo/sub", "github.com/user/repo", "../sub", `invalid module directory "../sub": must be a clean path relative to the repository root`},
+	{"bad path", "github.com/user/repo", "", `malformed module path "bad path": invalid char ' '`},
+}
+
+func TestCheckModulePathConsistency(t *testing.T) {
+	for _, tt := range modulePathConsistencyTests {
+		err := CheckModulePathConsistency(tt.line, tt.root, tt.dir)
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("CheckModulePathConsistency(%q, %q, %q): %v", tt.line, tt.root, tt.dir, err)
+			}
+		} else if err == nil || err.Error() != tt.err {
+			t.Errorf("CheckModulePathConsistency(%q, %q, %q) = %v, want %q", tt.line, tt.root, tt.dir, err, tt.err)
+		}
+	}
+}
+
+func TestPackagePaths(t *testing.T) {
+	paths, err := PackagePaths("rsc.io/quote/v3", []string{"buggy", "", "internal/x"})
+	if err != nil {
+		t.Fatalf("PackagePaths: %v", err)
+	}
+	want := "rsc.io/quote/v3 rsc.io/quote/v3/buggy rsc.io/quote/v3/internal/x"
+	if got := strings.Join(paths, " "); got != want {
+		t.Errorf("PackagePaths = %q, want %q", got, want)
+	}
+	for _, within := range []string{"buggy", "", "internal/x"} {
+		path := "rsc.io/quote/v3"
+		if within != "" {
+			path += "/" + within
+		}
+		if dir, ok := ImportPathParts("rsc.io/quote/v3", path); !ok || dir != within {
+			t.Errorf("ImportPathParts(%q) = %q, %v, want %q, true", path, dir, ok, within)
+		}
+	}
+
+	_, err = PackagePaths("rsc.io/quote", []string{"ok", "bad dir", "a//b"})
+	want = `invalid package directory "bad dir": malformed import path "rsc.io/quote/bad dir": invalid char ' '`
+	if err == nil || err.Error() != want {
+		t.Errorf("PackagePaths with bad dir: %v, want %q", err, want)
+	}
+}
+
+func TestInvalidPathError(t *testing.T) {
+	for _, tt := range []struct {
+		kind string
+		path string
+		err  error
+	}{
+		{"module", "bad path", CheckPath("bad path")},
+		{"import", "a//b", CheckImportPath("a//b")},
+		{"file", "a/b:c", CheckFilePath("a/b:c")},
+	} {
+		pe, ok := tt.err.(*InvalidPathError)
+		if !ok || pe.Kind != tt.kind || pe.Path != tt.path {
+			t.Errorf("error %v (%T), want *InvalidPathError{Kind: %q, Path: %q}", tt.err, tt.err, tt.kind, tt.path)
+			continue
+		}
+		if want := fmt.Sprintf("malformed %s path %q: %v", tt.kind, tt.path, pe.Err); tt.err.Error() != want {
+			t.Errorf("error %q, want %q", tt.err, want)
+		}
+	}
+}
+
+func TestInvalidPathErrorVersionMismatch(t *testing.T) {
+	// A version that does not match its path is not a malformed path.
+	if err := Check("x.y/z", "v2.0.0"); err == nil {
+		t.Errorf("Check(%q, %q) succeeded, want error", "x.y/z", "v2.0.0")
+	} else if _, ok := err.(*InvalidPathError); ok {
+		t.Errorf("Check(%q, %q) = %v, want version mismatch, not *InvalidPathError", "x.y/z", "v2.0.0", err)
+	}
+}
+
+var pathReasonTests = []struct {
+	check  func(string) error
+	path   string
+	reason error
+}{
+	{CheckPath, "", ErrEmptyPath},
+	{CheckPath, "x.y/\xff", ErrInvalidUTF8},
+	{CheckPath, "x.y/../z", ErrDoubleDot},
+	{CheckPath, "x.y//z", ErrDoubleSlash},
+	{CheckPath, "x.y/z/", ErrTrailingSlash},
+	{CheckPath, "nodot/z", ErrMissingDot},
+	{CheckPath, "-x.y/z", ErrLeadingDash},
+	{CheckPath, "x.y/.z", ErrLeadingDot},
+	{CheckPath, "x.y/z.", ErrTrailingDot},
+	{CheckPath, "x.y/" + strings.Repeat("z", 256), ErrElemTooLong},
+	{CheckPath, "x.y/con", ErrWindowsName},
+	{CheckPath, "x.y/z/v1", ErrMajorSuffix},
+	{CheckFilePath, "a/.", ErrDotsElem},
+	{CheckImportPath, "x.y/z/.", ErrDotsElem},
+}
+
+func TestPathReason(t *testing.T) {
+	for _, tt := range pathReasonTests {
+		err := tt.check(tt.path)
+		pe, ok := err.(*InvalidPathError)
+		if !ok {
+			t.Errorf("check(%q) = %v, want *InvalidPathError", tt.path, err)
+			continue
+		}
+		reason := pe.Err
+		if u, ok := reason.(interface{ Unwrap() error }); ok {
+			reason = u.Unwrap()
+		}
+		if reason != tt.reason {
+			t.Errorf("check(%q) = %v, want reason %q", tt.path, err, tt.reason)
+		}
+	}
+}
+
+var invalidCharTests = []struct {
+	check            func(string) error
+	path             string
+	char             rune
+	offset, runeOffs int
+}{
+	{CheckImportPath, "example.com/a b", ' ', 13, 13},
+	{CheckImportPath, "x;y", ';', 1, 1},
+	{CheckPath, "example.com/x/y*z", '*', 15, 15},
+	{CheckFilePath, "ünï/cödé/a:b", ':', 14, 10},
+	{CheckPath, "exa_mple.com/x", '_', 3, 3},
+	{CheckPath, "ex~ample.com/x", '~', 2, 2},
+	{CheckPathAllowPort, "example.com:8080/a b", ' ', 18, 18},
+	{CheckPathAllowPort, "exa_mple.com:8080/ab", '_', 3, 3},
+	{CheckPathAllowPort, "localhost:8080/a/b c", ' ', 18, 18},
+}
+
+func TestInvalidCharOffset(t *testing.T) {
+	for _, tt := range invalidCharTests {
+		err := tt.check(tt.path)
+		pe, ok := err.(*InvalidPathError)
+		if !ok {
+			t.Errorf("check(%q) = %v, want *InvalidPathError", tt.path, err)
+			continue
+		}
+		ce, ok := pe.Err.(*InvalidCharError)
+		if !ok {
+			t.Errorf("check(%q) = %v, want wrapped *InvalidCharError", tt.path, err)
+			continue
+		}
+		if ce.Char != tt.char || ce.Offset != tt.offset || ce.RuneOffset != tt.runeOffs {
+			t.Errorf("check(%q): InvalidCharError{%q, %d, %d}, want {%q, %d, %d}", tt.path, ce.Char, ce.Offset, ce.RuneOffset, tt.char, tt.offset, tt.runeOffs)
+		}
+		if !strings.HasPrefix(tt.path[ce.Offset:], string(tt.char)) {
+			t.Errorf("check(%q): byte offset %d does not point at %q", tt.path, ce.Offset, tt.char)
+		}
+	}
+}
+
+func TestInvalidCharFirstElem(t *testing.T) {
+	path := "ex_ample.com/x"
+	err := CheckPath(path)
+	pe, ok := err.(*InvalidPathError)
+	if !ok {
+		t.Fatalf("CheckPath(%q) = %v, want *InvalidPathError", path, err)
+	}
+	ce, ok := pe.Err.(*InvalidCharError)
+	if !ok {
+		t.Fatalf("CheckPath(%q) = %v, want wrapped *InvalidCharError", path, err)
+	}
+	if ce.Char != '_' || ce.Offset != 2 || ce.RuneOffset != 2 {
+		t.Errorf("CheckPath(%q): InvalidCharError{%q, %d, %d}, want {'_', 2, 2}", path, ce.Char, ce.Offset, ce.RuneOffset)
+	}
+	if want := `malformed module path "ex_ample.com/x": invalid char '_' in first path element`; err.Error() != want {
+		t.Errorf("CheckPath(%q) = %q, want %q", path, err, want)
+	}
+}
+
+func TestCheckPaths(t *testing.T) {
+	if err := CheckPaths([]string{"rsc.io/quote", "x.y/z/v2"}); err != nil {
+		t.Errorf("CheckPaths(valid) = %v, want nil", err)
+	}
+	if err := CheckPaths(nil); err != nil {
+		t.Errorf("CheckPaths(nil) = %v, want nil", err)
+	}
+
+	err := CheckPaths([]string{"bad path", "rsc.io/quote", "nodot/x", "x.y/z/v1"})
+	want := `malformed module path "bad path": invalid char ' '
+malformed module path "nodot/x": missing dot in first path element
+malformed module path "x.y/z/v1": invalid version`
+	if err == nil || err.Error() != want {
+		t.Fatalf("CheckPaths = %v, want:\n%s", err, want)
+	}
+	u, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		t.Fatalf("CheckPaths error %T has no Unwrap() []error method", err)
+	}
+	var paths []string
+	for _, e := range u.Unwrap() {
+		pe, ok := e.(*InvalidPathError)
+		if !ok {
+			t.Fatalf("CheckPaths wrapped %T, want *InvalidPathError", e)
+		}
+		paths = append(paths, pe.Path)
+	}
+	if got := strings.Join(paths, ","); got != "bad path,nodot/x,x.y/z/v1" {
+		t.Errorf("CheckPaths wrapped errors for %q, want bad path,nodot/x,x.y/z/v1", got)
+	}
+}
+
+var checkPathMajorTests = []struct {
+	v, pathMajor string
+	err          string
+}{
+	{"v1.2.3", "", ""},
+	{"v0.1.0", "", ""},
+	{"v2.0.0+incompatible", "", ""},
+	{"v2.1.0", "/v2", ""},
+	{"v3.0.0", ".v3", ""},
+	{"v1.0.0", ".v1-unstable", ""},
+	{"v0.0.0-20161208181325-20d25e280405", ".v1", ""},
+	{"v2.0.0", "", `version "v2.0.0" invalid: should be v0 or v1, not v2`},
+	{"v1.5.0", "/v2", `version "v1.5.0" invalid: should be v2, not v1`},
+	{"v2.0.0", ".v3", `version "v2.0.0" invalid: should be v3, not v2`},
+	{"bad", "/v2", `version "bad" invalid: not a semantic version`},
+	{"", "", `version "" invalid: not a semantic version`},
+}
+
+func TestCheckPathMajor(t *testing.T) {
+	for _, tt := range checkPathMajorTests {
+		err := CheckPathMajor(tt.v, tt.pathMajor)
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("CheckPathMajor(%q, %q): %v", tt.v, tt.pathMajor, err)
+			}
+		} else if err == nil || err.Error() != tt.err {
+			t.Errorf("CheckPathMajor(%q, %q) = %v, want %q", tt.v, tt.pathMajor, err, tt.err)
+		}
+		if ok := MatchPathMajor(tt.v, tt.pathMajor); ok != (err == nil) {
+			t.Errorf("MatchPathMajor(%q, %q) = %v, but CheckPathMajor = %v", tt.v, tt.pathMajor, ok, err)
+		}
+	}
+}
+
+var unicodeImportPathTests = []struct {
+	path string
+	ok   bool
+}{
+	{"example.com/café", true},
+	{"example.com/Straße/日本語", true},
+	{"example.com/λόγο", true},
+	{"example.com/\u03bb\u1f79\u03b3\u03bf", false}, // U+1F79 is NFC U+03CC
+	{"example.com/\ud55c", true},                    // Hangul syllable 한
+	{"example.com/\u1112\u1161\u11ab", false},       // 한 as conjoining jamo
+	{"example.com/\u212b", false},                   // Angstrom sign is NFC U+00C5
+	{"example.com/\u00e9", true},
+	{"example.com/\uf900", false}, // CJK compatibility ideograph
+	{"example.com/a b", false},
+	{"example.com/Kelvin", false}, // Kelvin sign folds to ASCII k
+	{"example.com/ſhort", false},  // long s folds to ASCII s
+	{"example.com/Ωmega", false},  // Ω also folds with the Ohm sign
+	{"example.com/σ", false},      // σ, ς, and Σ all fold together
+	{"example.com/café", false},  // combining mark
+	{"example.com/x™", false},     // symbol, not a letter
+	{"example.com/../x", false},
+}
+
+func TestCheckImportPathWithOptions(t *testing.T) {
+	for _, tt := range unicodeImportPathTests {
+		err := CheckImportPathWithOptions(tt.path, CheckOptions{AllowUnicode: true})
+		if ok := err == nil; ok != tt.ok {
+			t.Errorf("CheckImportPathWithOptions(%q, AllowUnicode) = %v, want ok=%v", tt.path, err, tt.ok)
+		}
+		err = CheckImportPathWithOptions(tt.path, CheckOptions{})
+		if want := CheckImportPath(tt.path); fmt.Sprint(err) != fmt.Sprint(want) {
+			t.Errorf("CheckImportPathWithOptions(%q, CheckOptions{}) = %v, want %v", tt.path, err, want)
+		}
+	}
+}
+
+func TestEscapePathHex(t *testing.T) {
+	for _, path := range []string{"rsc.io/Quote", "github.com/Azure/azure-sdk-for-go/v2", "gopkg.in/yaml.v2", "example.com/café"} {
+		escaped := EscapePathHex(path)
+		if strings.ToLower(escaped) != escaped {
+			t.Errorf("EscapePathHex(%q) = %q, not lower case", path, escaped)
+		}
+		if n, m := strings.Count(escaped, "/"), strings.Count(path, "/"); n != m {
+			t.Errorf("EscapePathHex(%q) = %q, has %d slashes, want %d", path, escaped, n, m)
+		}
+		back, err := UnescapePathHex(escaped)
+		if err != nil || back != path {
+			t.Errorf("UnescapePathHex(%q) = %q, %v, want %q, nil", escaped, back, err, path)
+		}
+	}
+	if got, want := EscapePathHex("rsc.io/Quote"), "7273632e696f/51756f7465"; got != want {
+		t.Errorf("EscapePathHex(%q) = %q, want %q", "rsc.io/Quote", got, want)
+	}
+
+	for _, bad := range []string{"7273632E696F/51756f7465", "727/51", "xy", "7273632e696f/51756f746"} {
+		if path, err := UnescapePathHex(bad); err == nil {
+			t.Errorf("UnescapePathHex(%q) = %q, want error", bad, path)
+		}
+	}
+}
+
+func TestEscapePathAppend(t *testing.T) {
+	for _, tt := range checkPathTests {
+		if !tt.ok {
+			buf, err := EscapePathAppend([]byte("prefix:"), tt.path)
+			if err == nil || string(buf) != "prefix:" {
+				t.Errorf("EscapePathAppend(%q) = %q, %v, want \"prefix:\", error (invalid path)", tt.path, buf, err)
+			}
+		}
+	}
+
+	for _, tt := range escapeTests {
+		want := tt.esc
+		if want == "" {
+			want = tt.path
+		}
+		buf, err := EscapePathAppend([]byte("prefix:"), tt.path)
+		if err != nil {
+			t.Errorf("EscapePathAppend(%q): unexpected error: %v", tt.path, err)
+			continue
+		}
+		if string(buf) != "prefix:"+want {
+			t.Errorf("EscapePathAppend(%q) = %q, want %q", tt.path, buf, "prefix:"+want)
+		}
+	}
+
+	buf := make([]byte, 0, 64)
+	for _, path := range []string{"github.com/go-yaml/yaml", "github.com/Azure/azure-sdk-for-go"} {
+		allocs := testing.AllocsPerRun(100, func() {
+			buf, _ = EscapePathAppend(buf[:0], path)
+		})
+		if allocs != 0 {
+			t.Errorf("EscapePathAppend(buf, %q): %v allocs, want 0", path, allocs)
+		}
+	}
+}
+
+func BenchmarkEscapePath(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		EscapePath("github.com/go-yaml/yaml/v2")
+	}
+}
+
+func BenchmarkEscapePathAppend(b *testing.B) {
+	buf := make([]byte, 0, 64)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf, _ = EscapePathAppend(buf[:0], "github.com/go-yaml/yaml/v2")
+	}
+}
+
+func TestVersionText(t *testing.T) {
+	for _, m := range []Version{
+		{"rsc.io/quote/v3", "v3.1.0"},
+		{"x.y/z", "v2.0.0+incompatible"},
+		{"x.y/z", ""},
+	} {
+		text, err := m.MarshalText()
+		if err != nil {
+			t.Fatalf("%v.MarshalText: %v", m, err)
+		}
+		var back Version
+		if err := back.UnmarshalText(text); err != nil || back != m {
+			t.Errorf("UnmarshalText(%q) = %v, %v, want %v", text, back, err, m)
+		}
+	}
+	if text, _ := (Version{"x.y/z", ""}).MarshalText(); string(text) != "x.y/z" {
+		t.Errorf("MarshalText of empty version = %q, want %q", text, "x.y/z")
+	}
+
+	for _, bad := range []string{"x.y/z@", "x.y/z@latest", "x.y/z@v2.0.0", "bad path@v1.0.0", "nodot"} {
+		m := Version{"keep", "v1.0.0"}
+		if err := m.UnmarshalText([]byte(bad)); err == nil || m != (Version{"keep", "v1.0.0"}) {
+			t.Errorf("UnmarshalText(%q) = %v, %v, want error and no change", bad, m, err)
+		}
+	}
+
+	// What MarshalText rejects is exactly what UnmarshalText would reject.
+	for _, m := range []Version{
+		{"x.y/z", "latest"},
+		{"x.y/z", "v1.0.0/go.mod"},
+		{"x.y/z", "v2.0.0"},
+		{"bad path", "v1.0.0"},
+		{"nodot", ""},
+	} {
+		if text, err := m.MarshalText(); err == nil {
+			t.Errorf("%v.MarshalText() = %q, want error", m, text)
+		}
+		var back Version
+		if err := back.UnmarshalText([]byte(m.String())); err == nil {
+			t.Errorf("UnmarshalText(%q) succeeded, want error", m.String())
+		}
+	}
+}
+
+var parseVersionTests = []struct {
+	in  string
+	out Version
+	err string
+}{
+	{"rsc.io/quote/v3@v3.1.0", Version{"rsc.io/quote/v3", "v3.1.0"}, ""},
+	{"rsc.io/quote", Version{"rsc.io/quote", ""}, ""},
+	{"x.y/z@v2.0.0+incompatible", Version{"x.y/z", "v2.0.0+incompatible"}, ""},
+	{"x.y/z@", Version{}, "malformed semantic version "},
+	{"x.y/z@latest", Version{}, "malformed semantic version latest"},
+	{"x.y/z/v2@v1.0.0", Version{}, "mismatched module path x.y/z/v2 and version v1.0.0 (want /v2)"},
+	{"x@y/z@v1.0.0", Version{}, `malformed module path "x@y/z": invalid char '@'`},
+	{"nodot", Version{}, `malformed module path "nodot": missing dot in first path element`},
+}
+
+func TestParseVersion(t *testing.T) {
+	for _, tt := range parseVersionTests {
+		m, err := ParseVersion(tt.in)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("ParseVersion(%q) = %v, %v, want error %q", tt.in, m, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || m != tt.out {
+			t.Errorf("ParseVersion(%q) = %v, %v, want %v, nil", tt.in, m, err, tt.out)
+		}
+		if tt.out.Version != "" && m.String() != tt.in {
+			t.Errorf("ParseVersion(%q).String() = %q, want round trip", tt.in, m.String())
+		}
+	}
+}
+
+func TestSortStable(t *testing.T) {
+	list := []Version{
+		{"x.y/z", "v1.2"},
+		{"a.b/c", "v1.0.0"},
+		{"x.y/z", "v1.2.0+meta"},
+		{"x.y/z", "v1.1.0"},
+		{"x.y/z", "v1.2.0"},
+		{"x.y/z", "v1.1.0/go.mod"},
+	}
+	SortStable(list)
+	var got []string
+	for _, m := range list {
+		got = append(got, m.String())
+	}
+	want := "a.b/c@v1.0.0 x.y/z@v1.1.0 x.y/z@v1.1.0/go.mod x.y/z@v1.2 x.y/z@v1.2.0+meta x.y/z@v1.2.0"
+	if strings.Join(got, " ") != want {
+		t.Errorf("SortStable:\nhave %s\nwant %s", strings.Join(got, " "), want)
+	}
+}
+
+func TestSortByVersionDesc(t *testing.T) {
+	list := []Version{
+		{"x.y/z", "v1.2.0"},
+		{"a.b/c", "v1.0.0"},
+		{"x.y/z", "v1.10.0"},
+		{"x.y/z", "v1.2.0/go.mod"},
+		{"a.b/c", "v2.0.0+incompatible"},
+		{"x.y/z", "v1.10.0-rc.1"},
+	}
+	SortByVersionDesc(list)
+	var got []string
+	for _, m := range list {
+		got = append(got, m.String())
+	}
+	want := "a.b/c@v2.0.0+incompatible a.b/c@v1.0.0 x.y/z@v1.10.0 x.y/z@v1.10.0-rc.1 x.y/z@v1.2.0/go.mod x.y/z@v1.2.0"
+	if strings.Join(got, " ") != want {
+		t.Errorf("SortByVersionDesc:\nhave %s\nwant %s", strings.Join(got, " "), want)
+	}
+}
+
+func TestDedup(t *testing.T) {
+	list := []Version{
+		{"x.y/z", "v1.0.0"},
+		{"a.b/c", "v1.0.0"},
+		{"x.y/z", "v1.0.0/go.mod"},
+		{"x.y/z", "v1.0.0"},
+		{"a.b/c", "v1.0.0"},
+		{"x.y/z", "v1.0.0/go.mod"},
+		{"x.y/z", "v1.1.0"},
+	}
+	out := Dedup(list)
+	var got []string
+	for _, m := range out {
+		got = append(got, m.String())
+	}
+	want := "a.b/c@v1.0.0 x.y/z@v1.0.0 x.y/z@v1.0.0/go.mod x.y/z@v1.1.0"
+	if strings.Join(got, " ") != want {
+		t.Errorf("Dedup:\nhave %s\nwant %s", strings.Join(got, " "), want)
+	}
+	if &out[0] != &list[0] {
+		t.Errorf("Dedup did not work in place")
+	}
+	if out := Dedup(nil); len(out) != 0 {
+		t.Errorf("Dedup(nil) = %v, want empty", out)
+	}
+
+	// Different spellings that Sort considers equal
+	// must not hide exact duplicates from each other.
+	list = []Version{
+		{"x.y/z", "v1.2.0"},
+		{"x.y/z", "v1.2"},
+		{"x.y/z", "v1.2.0"},
+		{"x.y/z", "v1.0.0+meta"},
+		{"x.y/z", "v1.0.0"},
+		{"x.y/z", "v1.0.0+meta"},
+	}
+	got = nil
+	for _, m := range Dedup(list) {
+		got = append(got, m.String())
+	}
+	want = "x.y/z@v1.0.0 x.y/z@v1.0.0+meta x.y/z@v1.2 x.y/z@v1.2.0"
+	if strings.Join(got, " ") != want {
+		t.Errorf("Dedup:\nhave %s\nwant %s", strings.Join(got, " "), want)
+	}
+}
+
+func TestDiffIntersect(t *testing.T) {
+	before := []Version{
+		{"a.b/c", "v1.0.0"},
+		{"golang.org/x/text", "v0.3.0"},
+		{"rsc.io/quote", "v1.5.2"},
+		{"rsc.io/sampler", "v1.3.0"},
+	}
+	after := []Version{
+		{"a.b/c", "v1.0.0"},
+		{"example.com/new", "v0.1.0"},
+		{"rsc.io/quote", "v1.5.2"},
+		{"rsc.io/sampler", "v1.99.99"},
+		{"rsc.io/z", "v1.0.0"},
+	}
+	str := func(list []Version) string {
+		var s []string
+		for _, m := range list {
+			s = append(s, m.String())
+		}
+		return strings.Join(s, " ")
+	}
+	added, removed := Diff(before, after)
+	if got, want := str(added), "example.com/new@v0.1.0 rsc.io/sampler@v1.99.99 rsc.io/z@v1.0.0"; got != want {
+		t.Errorf("Diff added = %s, want %s", got, want)
+	}
+	if got, want := str(removed), "golang.org/x/text@v0.3.0 rsc.io/sampler@v1.3.0"; got != want {
+		t.Errorf("Diff removed = %s, want %s", got, want)
+	}
+	if got, want := str(Intersect(before, after)), "a.b/c@v1.0.0 rsc.io/quote@v1.5.2"; got != want {
+		t.Errorf("Intersect = %s, want %s", got, want)
+	}
+	if added, removed := Diff(before, before); added != nil || removed != nil {
+		t.Errorf("Diff(before, before) = %v, %v, want nil, nil", added, removed)
+	}
+	if both := Intersect(before, nil); both != nil {
+		t.Errorf("Intersect(before, nil) = %v, want nil", both)
+	}
+}
+
+var proxyPathTests = []struct {
+	m    Version
+	ext  string
+	path string
+	err  string
+}{
+	{Version{"github.com/Azure/go", "v1.2.0"}, ".info", "github.com/!azure/go/@v/v1.2.0.info", ""},
+	{Version{"rsc.io/quote/v3", "v3.1.0"}, ".mod", "rsc.io/quote/v3/@v/v3.1.0.mod", ""},
+	{Version{"x.y/z", "v1.0.0-RC1"}, ".zip", "x.y/z/@v/v1.0.0-!r!c1.zip", ""},
+	{Version{"x.y/z", "v1.0.0"}, "zip", "", `unknown module proxy file extension "zip": must be .info, .mod, or .zip`},
+	{Version{"x.y/z", "v1.0.0"}, ".list", "", `unknown module proxy file extension ".list": must be .info, .mod, or .zip`},
+	{Version{"bad path", "v1.0.0"}, ".mod", "", `malformed module path "bad path": invalid char ' '`},
+	{Version{"x.y/z", "v1.0.0!"}, ".mod", "", `disallowed version string "v1.0.0!"`},
+}
+
+func TestProxyPath(t *testing.T) {
+	for _, tt := range proxyPathTests {
+		path, err := ProxyPath(tt.m, tt.ext)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("ProxyPath(%v, %q) = %q, %v, want error %q", tt.m, tt.ext, path, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || path != tt.path {
+			t.Errorf("ProxyPath(%v, %q) = %q, %v, want %q, nil", tt.m, tt.ext, path, err, tt.path)
+		}
+	}
+
+	if path, err := ProxyLatestPath("github.com/Azure/go"); err != nil || path != "github.com/!azure/go/@latest" {
+		t.Errorf("ProxyLatestPath = %q, %v, want %q, nil", path, err, "github.com/!azure/go/@latest")
+	}
+	if path, err := ProxyLatestPath("bad path"); err == nil {
+		t.Errorf("ProxyLatestPath(%q) = %q, want error", "bad path", path)
+	}
+}
@@ -0,0 +1,364 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Pseudo-versions
+//
+// Code authors are expected to tag the revisions they want users to use,
+// including prereleases. However, not all authors tag versions at all,
+// and not all commits a user might want to try will have tags.
+// A pseudo-version is a version with a special form that allows us to
+// address an untagged commit and order that version with respect to
+// other versions we might encounter.
+//
+// A pseudo-version takes one of the general forms:
+//
+//	(1) vX.0.0-yyyymmddhhmmss-abcdef123456
+//	(2) vX.Y.(Z+1)-0.yyyymmddhhmmss-abcdef123456
+//	(3) vX.Y.(Z+1)-0.yyyymmddhhmmss-abcdef123456+incompatible
+//	(4) vX.Y.Z-pre.0.yyyymmddhhmmss-abcdef123456
+//	(5) vX.Y.Z-pre.0.yyyymmddhhmmss-abcdef123456+incompatible
+//
+// If there is no recently tagged version with the right major version vX,
+// then form (1) is used, creating a space of pseudo-versions at the bottom
+// of the vX version range, less than any tagged version, including the unlikely v0.0.0.
+//
+// If the most recent tagged version before the target commit is vX.Y.Z or vX.Y.Z+incompatible,
+// then the pseudo-version uses form (2) or (3), making it a prerelease for the next
+// possible semantic version after vX.Y.Z. The leading 0 segment in the prerelease string
+// ensures that the pseudo-version compares less than possible future explicit prereleases
+// like vX.Y.(Z+1)-rc1 or vX.Y.(Z+1)-1.
+//
+// If the most recent tagged version before the target commit is vX.Y.Z-pre or vX.Y.Z-pre+incompatible,
+// then the pseudo-version uses form (4) or (5), making it a slightly later prerelease.
+
+package module
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/radeksimko/mod/lazyregexp"
+	"github.com/radeksimko/mod/semver"
+)
+
+var pseudoVersionRE = lazyregexp.New(`^v[0-9]+\.(0\.0-|\d+\.\d+-([^+]*\.)?0\.)\d{14}-[A-Za-z0-9]+(\+[0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*)?$`)
+
+// IsPseudoVersion reports whether v is a pseudo-version.
+// Build metadata does not affect the answer, so a version like
+// v2.0.0-20200101000000-abcdef123456+incompatible is both
+// a pseudo-version and an incompatible version (see IsIncompatible).
+func IsPseudoVersion(v string) bool {
+	return strings.Count(v, "-") >= 2 && semver.IsValid(v) && pseudoVersionRE.MatchString(v)
+}
+
+// IsIncompatible reports whether v is a valid semantic version
+// with the "+incompatible" build suffix, marking a version vN (N ≥ 2)
+// of a module that has no go.mod file and so no /vN path suffix.
+// The suffix is independent of the rest of the version: a pseudo-version
+// may be incompatible too, and is then both a pseudo-version and incompatible.
+func IsIncompatible(v string) bool {
+	return semver.Build(v) == "+incompatible"
+}
+
+// PseudoVersionBaseForTag returns the prefix of any pseudo-version
+// for a commit whose most recent tagged ancestor is latestTag,
+// up to but not including the timestamp and revision segment.
+// For example:
+//
+//	PseudoVersionBaseForTag("")            == "v0.0.0-"
+//	PseudoVersionBaseForTag("v1.2.3")      == "v1.2.4-0."
+//	PseudoVersionBaseForTag("v1.2.3-pre")  == "v1.2.3-pre.0."
+//
+// latestTag must be empty or a canonical semantic version, optionally
+// followed by build metadata. The build metadata is not part of the result:
+// a "+incompatible" suffix, for example, must be appended to the finished
+// pseudo-version by the caller.
+func PseudoVersionBaseForTag(latestTag string) (string, error) {
+	if latestTag == "" {
+		return "v0.0.0-", nil
+	}
+	v := semver.Canonical(latestTag)
+	if v == "" || v+semver.Build(latestTag) != latestTag {
+		return "", &InvalidVersionError{Version: latestTag, Err: errors.New("tag is not a canonical semantic version")}
+	}
+	if semver.Prerelease(v) != "" {
+		return v + ".0.", nil
+	}
+	i := len(semver.MajorMinor(v)) + 1
+	return v[:i] + incDecimal(v[i:]) + "-0.", nil
+}
+
+// PseudoVersionTimestampFormat is the layout of the timestamp in a pseudo-version.
+const PseudoVersionTimestampFormat = "20060102150405"
+
+// PseudoVersion returns a pseudo-version for the given major version ("v1")
+// preexisting older tagged version ("" or "v1.2.3" or "v1.2.3-pre"), revision time,
+// and revision identifier (usually a 12-byte commit hash prefix).
+// If major is empty, it defaults to "v0". A revision identifier longer than
+// 12 characters is truncated to 12. The time is formatted in UTC using
+// PseudoVersionTimestampFormat. Any build suffix of older, such as
+// "+incompatible", is carried over to the result.
+func PseudoVersion(major, older string, t time.Time, rev string) string {
+	if major == "" {
+		major = "v0"
+	}
+	if len(rev) > 12 {
+		rev = rev[:12]
+	}
+	segment := t.UTC().Format(PseudoVersionTimestampFormat) + "-" + rev
+	cv := semver.Canonical(older)
+	if cv == "" {
+		return major + ".0.0-" + segment // form (1)
+	}
+	base, _ := PseudoVersionBaseForTag(cv) // forms (2) to (5); cv is canonical, so no error
+	return base + segment + semver.Build(older)
+}
+
+// DevVersion returns a pseudo-version naming the commit rev, made at time t,
+// whose most recent tagged ancestor is baseVersion (empty if there is none).
+// The result is a valid semantic version that can be used directly in a
+// require directive, such as "v1.2.4-0.20191109021931-daa7c04131f5".
+// If baseVersion is empty, the result is a v0.0.0 pseudo-version;
+// if it has the "+incompatible" suffix, so does the result.
+// Unlike PseudoVersion, DevVersion checks its arguments:
+// baseVersion must be empty or canonical, and rev must be a 12-character
+// lower-case hexadecimal commit hash prefix.
+func DevVersion(baseVersion string, t time.Time, rev string) (string, error) {
+	if !isRevPrefix(rev) {
+		return "", fmt.Errorf("invalid revision %q: must be 12 lower-case hexadecimal digits", rev)
+	}
+	if _, err := PseudoVersionBaseForTag(baseVersion); err != nil {
+		return "", err
+	}
+	if build := semver.Build(baseVersion); build != "+incompatible" {
+		baseVersion = strings.TrimSuffix(baseVersion, build)
+	}
+	return PseudoVersion("", baseVersion, t, rev), nil
+}
+
+// CanonicalPseudoVersion returns the canonical form of the pseudo-version v,
+// as CanonicalVersion would, after checking that v has the strict shape of
+// a pseudo-version: one of the forms listed above, with a valid 14-digit
+// UTC timestamp and a 12-character lower-case hexadecimal revision.
+// Unlike CanonicalVersion, which treats a pseudo-version as an ordinary
+// prerelease, it reports malformations such as an 11-character revision
+// or a timestamp naming the 13th month as errors rather than passing them
+// through. Build metadata other than "+incompatible" is removed.
+func CanonicalPseudoVersion(v string) (string, error) {
+	cv := CanonicalVersion(v)
+	if cv == "" {
+		return "", &InvalidVersionError{Version: v, Pseudo: true, Err: errors.New("not a semantic version")}
+	}
+	_, timestamp, _, _, err := parsePseudoVersion(cv)
+	if err != nil {
+		return "", &InvalidVersionError{Version: v, Pseudo: true, Err: err.(*InvalidVersionError).Err}
+	}
+	if _, err := time.Parse(PseudoVersionTimestampFormat, timestamp); err != nil {
+		return "", &InvalidVersionError{Version: v, Pseudo: true, Err: fmt.Errorf("malformed time %q", timestamp)}
+	}
+	return cv, nil
+}
+
+// NewerThan returns the versions in the list that are newer than t,
+// in their original order. A pseudo-version is newer than t if the
+// commit timestamp recorded in it is after t. A tagged version carries
+// no timestamp and so cannot be placed in time: NewerThan always includes
+// it, so callers interested only in pseudo-versions must drop the tagged
+// versions from the result themselves.
+// NewerThan returns an error if a version is not a valid semantic version
+// or is a malformed pseudo-version, such as one whose timestamp
+// is not a valid time.
+func NewerThan(versions []string, t time.Time) ([]string, error) {
+	var newer []string
+	for _, v := range versions {
+		if !semver.IsValid(v) {
+			return nil, &InvalidVersionError{Version: v, Err: errors.New("not a semantic version")}
+		}
+		if IsPseudoVersion(v) {
+			vt, err := PseudoVersionTime(v)
+			if err != nil {
+				return nil, err
+			}
+			if !vt.After(t) {
+				continue
+			}
+		}
+		newer = append(newer, v)
+	}
+	return newer, nil
+}
+
+var errPseudoSyntax = errors.New("syntax error")
+
+// PseudoVersionTime returns the time stamp of the pseudo-version v,
+// in UTC. It returns an error if v is not a pseudo-version or if its
+// 14-digit timestamp does not name a valid time.
+func PseudoVersionTime(v string) (time.Time, error) {
+	_, timestamp, _, _, err := parsePseudoVersion(v)
+	if err != nil {
+		return time.Time{}, err
+	}
+	t, err := time.Parse(PseudoVersionTimestampFormat, timestamp)
+	if err != nil {
+		return time.Time{}, &InvalidVersionError{
+			Version: v,
+			Pseudo:  true,
+			Err:     fmt.Errorf("malformed time %q", timestamp),
+		}
+	}
+	return t, nil
+}
+
+// PseudoVersionRev returns the revision identifier of the pseudo-version v,
+// such as "daa7c04131f5" for v0.0.0-20191109021931-daa7c04131f5.
+// It returns an error if v is not a pseudo-version or if the identifier
+// is not a 12-character lower-case hexadecimal commit hash prefix.
+func PseudoVersionRev(v string) (rev string, err error) {
+	_, _, rev, _, err = parsePseudoVersion(v)
+	return
+}
+
+// PseudoVersionBase returns the canonical parent version, if any, upon which
+// the pseudo-version v is based. It is the inverse of PseudoVersionBaseForTag:
+//
+//	PseudoVersionBase("v0.0.0-20191109021931-daa7c04131f5")        == ""
+//	PseudoVersionBase("v1.2.4-0.20191109021931-daa7c04131f5")      == "v1.2.3"
+//	PseudoVersionBase("v1.2.3-pre.0.20191109021931-daa7c04131f5")  == "v1.2.3-pre"
+//
+// A "+incompatible" suffix on v is kept on the result. If v has no parent
+// version, as in form (1), PseudoVersionBase returns the empty string.
+// It returns an error if v is not a pseudo-version with a 12-character
+// lower-case hexadecimal revision.
+func PseudoVersionBase(v string) (string, error) {
+	base, _, _, build, err := parsePseudoVersion(v)
+	if err != nil {
+		return "", err
+	}
+
+	switch pre := semver.Prerelease(base); pre {
+	case "":
+		// vX.0.0-yyyymmddhhmmss-abcdef123456 → ""
+		if build != "" {
+			// The "vX.0.0-" prefix says there is no parent tag, but a
+			// "+incompatible" suffix says that there is one, with a major
+			// version not compatible with the module path: the two disagree.
+			return "", &InvalidVersionError{
+				Version: v,
+				Pseudo:  true,
+				Err:     fmt.Errorf("lacks base version, but has build metadata %q", build),
+			}
+		}
+		return "", nil
+
+	case "-0":
+		// vX.Y.(Z+1)-0.yyyymmddhhmmss-abcdef123456 → vX.Y.Z
+		// vX.Y.(Z+1)-0.yyyymmddhhmmss-abcdef123456+incompatible → vX.Y.Z+incompatible
+		base = strings.TrimSuffix(base, pre)
+		i := strings.LastIndexByte(base, '.')
+		patch, ok := decDecimal(base[i+1:])
+		if !ok {
+			return "", &InvalidVersionError{
+				Version: v,
+				Pseudo:  true,
+				Err:     errors.New("patch version 0 has no predecessor"),
+			}
+		}
+		base = base[:i+1] + patch
+
+	default:
+		// vX.Y.Z-pre.0.yyyymmddhhmmss-abcdef123456 → vX.Y.Z-pre
+		// vX.Y.Z-pre.0.yyyymmddhhmmss-abcdef123456+incompatible → vX.Y.Z-pre+incompatible
+		base = strings.TrimSuffix(base, ".0")
+	}
+	return base + build, nil
+}
+
+// parsePseudoVersion splits the pseudo-version v into its base version
+// ("vX.0.0", "vX.Y.(Z+1)-0", or "vX.Y.Z-pre.0"), timestamp, revision,
+// and build suffix. It returns an *InvalidVersionError if v is not
+// a pseudo-version or its revision is not a 12-character commit hash prefix.
+func parsePseudoVersion(v string) (base, timestamp, rev, build string, err error) {
+	if !IsPseudoVersion(v) {
+		return "", "", "", "", &InvalidVersionError{
+			Version: v,
+			Pseudo:  true,
+			Err:     errPseudoSyntax,
+		}
+	}
+	orig := v
+	build = semver.Build(v)
+	v = strings.TrimSuffix(v, build)
+	j := strings.LastIndex(v, "-")
+	v, rev = v[:j], v[j+1:]
+	if !isRevPrefix(rev) {
+		return "", "", "", "", &InvalidVersionError{
+			Version: orig,
+			Pseudo:  true,
+			Err:     fmt.Errorf("revision %q must be 12 lower-case hexadecimal digits", rev),
+		}
+	}
+	i := strings.LastIndex(v, "-")
+	if j := strings.LastIndex(v, "."); j > i {
+		base = v[:j] // "vX.Y.Z-pre.0" or "vX.Y.(Z+1)-0"
+		timestamp = v[j+1:]
+	} else {
+		base = v[:i] // "vX.0.0"
+		timestamp = v[i+1:]
+	}
+	return base, timestamp, rev, build, nil
+}
+
+// isRevPrefix reports whether rev is a 12-character
+// lower-case hexadecimal commit hash prefix.
+func isRevPrefix(rev string) bool {
+	if len(rev) != 12 {
+		return false
+	}
+	for i := 0; i < len(rev); i++ {
+		if c := rev[i]; !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// decDecimal returns the decimal string decremented by 1,
+// or ok == false if the decimal is all zeros.
+func decDecimal(decimal string) (_ string, ok bool) {
+	// Scan right to left turning 0s to 9s until you find a digit to decrement.
+	digits := []byte(decimal)
+	i := len(digits) - 1
+	for ; i >= 0 && digits[i] == '0'; i-- {
+		digits[i] = '9'
+	}
+	if i < 0 {
+		return "", false
+	}
+	if i == 0 && digits[i] == '1' && len(digits) > 1 {
+		digits = digits[1:]
+	} else {
+		digits[i]--
+	}
+	return string(digits), true
+}
+
+// incDecimal returns the decimal string incremented by 1.
+func incDecimal(decimal string) string {
+	// Scan right to left turning 9s to 0s until you find a digit to increment.
+	digits := []byte(decimal)
+	i := len(digits) - 1
+	for ; i >= 0 && digits[i] == '9'; i-- {
+		digits[i] = '0'
+	}
+	if i >= 0 {
+		digits[i]++
+	} else {
+		// digits is all zeros
+		digits[0] = '1'
+		digits = append(digits, '0')
+	}
+	return string(digits)
+}
@@ -0,0 +1,261 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package module
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/radeksimko/mod/semver"
+)
+
+var pseudoBaseTests = []struct {
+	tag  string
+	base string // empty means error
+}{
+	{"", "v0.0.0-"},
+	{"v1.2.3", "v1.2.4-0."},
+	{"v1.2.9", "v1.2.10-0."},
+	{"v1.2.99", "v1.2.100-0."},
+	{"v2.0.0+incompatible", "v2.0.1-0."},
+	{"v1.2.3-pre", "v1.2.3-pre.0."},
+	{"v1.2.3-rc.1+incompatible", "v1.2.3-rc.1.0."},
+	{"v1.2", ""},
+	{"1.2.3", ""},
+	{"master", ""},
+}
+
+func TestPseudoVersionBaseForTag(t *testing.T) {
+	for _, tt := range pseudoBaseTests {
+		base, err := PseudoVersionBaseForTag(tt.tag)
+		if tt.base == "" {
+			if err == nil {
+				t.Errorf("PseudoVersionBaseForTag(%q) = %q, want error", tt.tag, base)
+			}
+			continue
+		}
+		if err != nil || base != tt.base {
+			t.Errorf("PseudoVersionBaseForTag(%q) = %q, %v, want %q, nil", tt.tag, base, err, tt.base)
+		}
+	}
+}
+
+var pseudoKindTests = []struct {
+	v            string
+	pseudo       bool
+	incompatible bool
+}{
+	{"v0.0.0-20191109021931-daa7c04131f5", true, false},
+	{"v1.2.4-0.20191109021931-daa7c04131f5", true, false},
+	{"v1.2.3-pre.0.20191109021931-daa7c04131f5", true, false},
+	{"v2.0.0-20200101000000-abcdef123456+incompatible", true, true},
+	{"v2.0.1-0.20200101000000-abcdef123456+incompatible", true, true},
+	{"v2.0.0-pre.0.20200101000000-abcdef123456+incompatible", true, true},
+	{"v2.0.0+incompatible", false, true},
+	{"v2.0.0-rc.1+incompatible", false, true},
+	{"v2.0.0-20200101000000-abcdef123456+meta", true, false},
+	{"v1.2.3", false, false},
+	{"v1.2.3-20191109021931-daa7c04131f5", false, false},
+	{"v0.0.0-2019110902193-daa7c04131f5", false, false},
+	{"v2.0.0+incompatible.x", false, false},
+}
+
+func TestPseudoIncompatible(t *testing.T) {
+	for _, tt := range pseudoKindTests {
+		if pseudo := IsPseudoVersion(tt.v); pseudo != tt.pseudo {
+			t.Errorf("IsPseudoVersion(%q) = %v, want %v", tt.v, pseudo, tt.pseudo)
+		}
+		if inc := IsIncompatible(tt.v); inc != tt.incompatible {
+			t.Errorf("IsIncompatible(%q) = %v, want %v", tt.v, inc, tt.incompatible)
+		}
+	}
+}
+
+var parsePseudoTests = []struct {
+	v    string
+	base string
+	time string
+	rev  string
+	err  string
+}{
+	{"v0.0.0-20191109021931-daa7c04131f5", "", "2019-11-09T02:19:31Z", "daa7c04131f5", ""},
+	{"v1.2.4-0.20191109021931-daa7c04131f5", "v1.2.3", "2019-11-09T02:19:31Z", "daa7c04131f5", ""},
+	{"v1.2.10-0.20191109021931-daa7c04131f5", "v1.2.9", "2019-11-09T02:19:31Z", "daa7c04131f5", ""},
+	{"v1.2.100-0.20191109021931-daa7c04131f5", "v1.2.99", "2019-11-09T02:19:31Z", "daa7c04131f5", ""},
+	{"v1.2.3-pre.0.20191109021931-daa7c04131f5", "v1.2.3-pre", "2019-11-09T02:19:31Z", "daa7c04131f5", ""},
+	{"v2.0.1-0.20191109021931-daa7c04131f5+incompatible", "v2.0.0+incompatible", "2019-11-09T02:19:31Z", "daa7c04131f5", ""},
+	{"v1.2.0-0.20191109021931-daa7c04131f5", "", "2019-11-09T02:19:31Z", "daa7c04131f5", `pseudo-version "v1.2.0-0.20191109021931-daa7c04131f5" invalid: patch version 0 has no predecessor`},
+	{"v2.0.0-20191109021931-daa7c04131f5+incompatible", "", "2019-11-09T02:19:31Z", "daa7c04131f5", `pseudo-version "v2.0.0-20191109021931-daa7c04131f5+incompatible" invalid: lacks base version, but has build metadata "+incompatible"`},
+	{"v1.2.3", "", "", "", `pseudo-version "v1.2.3" invalid: syntax error`},
+	{"v1.2.3-rc.1", "", "", "", `pseudo-version "v1.2.3-rc.1" invalid: syntax error`},
+	{"v0.0.0-20191109021931-abc", "", "", "", `pseudo-version "v0.0.0-20191109021931-abc" invalid: revision "abc" must be 12 lower-case hexadecimal digits`},
+	{"v1.2.4-0.20191109021931-DAA7C04131F5", "", "", "", `pseudo-version "v1.2.4-0.20191109021931-DAA7C04131F5" invalid: revision "DAA7C04131F5" must be 12 lower-case hexadecimal digits`},
+}
+
+func TestParsePseudoVersion(t *testing.T) {
+	for _, tt := range parsePseudoTests {
+		base, err := PseudoVersionBase(tt.v)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("PseudoVersionBase(%q) = %q, %v, want error %q", tt.v, base, err, tt.err)
+			}
+		} else if err != nil || base != tt.base {
+			t.Errorf("PseudoVersionBase(%q) = %q, %v, want %q, nil", tt.v, base, err, tt.base)
+		}
+
+		ts, err := PseudoVersionTime(tt.v)
+		if tt.time == "" {
+			if err == nil {
+				t.Errorf("PseudoVersionTime(%q) = %v, want error", tt.v, ts)
+			}
+		} else if err != nil || ts.Format(time.RFC3339) != tt.time {
+			t.Errorf("PseudoVersionTime(%q) = %v, %v, want %s", tt.v, ts, err, tt.time)
+		}
+
+		rev, err := PseudoVersionRev(tt.v)
+		if tt.rev == "" {
+			if err == nil {
+				t.Errorf("PseudoVersionRev(%q) = %q, want error", tt.v, rev)
+			}
+		} else if err != nil || rev != tt.rev {
+			t.Errorf("PseudoVersionRev(%q) = %q, %v, want %q", tt.v, rev, err, tt.rev)
+		}
+	}
+
+	for _, tt := range pseudoBaseTests {
+		if tt.base == "" || tt.tag == "" {
+			continue
+		}
+		v := tt.base + "20191109021931-daa7c04131f5" + semver.Build(tt.tag)
+		if base, err := PseudoVersionBase(v); err != nil || base != tt.tag {
+			t.Errorf("PseudoVersionBase(%q) = %q, %v, want %q", v, base, err, tt.tag)
+		}
+	}
+}
+
+var pseudoVersionTests = []struct {
+	major   string
+	older   string
+	rev     string
+	version string
+}{
+	{"", "", "daa7c04131f5", "v0.0.0-20191109021931-daa7c04131f5"},
+	{"v2", "", "daa7c04131f5", "v2.0.0-20191109021931-daa7c04131f5"},
+	{"v1", "v1.2.3", "daa7c04131f5", "v1.2.4-0.20191109021931-daa7c04131f5"},
+	{"v1", "v1.2.99", "daa7c04131f5", "v1.2.100-0.20191109021931-daa7c04131f5"},
+	{"v1", "v1.2.3-pre", "daa7c04131f5", "v1.2.3-pre.0.20191109021931-daa7c04131f5"},
+	{"v2", "v2.0.0+incompatible", "daa7c04131f5", "v2.0.1-0.20191109021931-daa7c04131f5+incompatible"},
+	{"v2", "v2.1.0-rc.1+incompatible", "daa7c04131f5", "v2.1.0-rc.1.0.20191109021931-daa7c04131f5+incompatible"},
+	{"", "", "daa7c04131f5a0b1c2d3e4f5a6b7c8d9e0f1a2b3", "v0.0.0-20191109021931-daa7c04131f5"},
+}
+
+func TestPseudoVersion(t *testing.T) {
+	when := time.Date(2019, 11, 9, 3, 19, 31, 0, time.FixedZone("", 1*60*60))
+	for _, tt := range pseudoVersionTests {
+		v := PseudoVersion(tt.major, tt.older, when, tt.rev)
+		if v != tt.version {
+			t.Errorf("PseudoVersion(%q, %q, %v, %q) = %q, want %q", tt.major, tt.older, when, tt.rev, v, tt.version)
+		}
+		if !IsPseudoVersion(v) {
+			t.Errorf("PseudoVersion(%q, %q, %v, %q) = %q, not a pseudo-version", tt.major, tt.older, when, tt.rev, v)
+		}
+		if base, err := PseudoVersionBase(v); err != nil || base != tt.older {
+			t.Errorf("PseudoVersionBase(%q) = %q, %v, want %q", v, base, err, tt.older)
+		}
+	}
+}
+
+var devVersionTests = []struct {
+	base    string
+	rev     string
+	version string // empty means error
+}{
+	{"", "daa7c04131f5", "v0.0.0-20191109021931-daa7c04131f5"},
+	{"v1.2.3", "daa7c04131f5", "v1.2.4-0.20191109021931-daa7c04131f5"},
+	{"v1.2.3-pre", "daa7c04131f5", "v1.2.3-pre.0.20191109021931-daa7c04131f5"},
+	{"v2.0.0+incompatible", "daa7c04131f5", "v2.0.1-0.20191109021931-daa7c04131f5+incompatible"},
+	{"v1.2.3+meta", "daa7c04131f5", "v1.2.4-0.20191109021931-daa7c04131f5"},
+	{"v1.2", "daa7c04131f5", ""},
+	{"", "daa7c04131f", ""},
+	{"", "daa7c04131f5a", ""},
+	{"", "DAA7C04131F5", ""},
+	{"", "master", ""},
+}
+
+func TestDevVersion(t *testing.T) {
+	when := time.Date(2019, 11, 9, 3, 19, 31, 0, time.FixedZone("", 1*60*60))
+	for _, tt := range devVersionTests {
+		v, err := DevVersion(tt.base, when, tt.rev)
+		if tt.version == "" {
+			if err == nil {
+				t.Errorf("DevVersion(%q, %v, %q) = %q, want error", tt.base, when, tt.rev, v)
+			}
+			continue
+		}
+		if err != nil || v != tt.version {
+			t.Errorf("DevVersion(%q, %v, %q) = %q, %v, want %q, nil", tt.base, when, tt.rev, v, err, tt.version)
+		}
+		if !IsPseudoVersion(v) {
+			t.Errorf("DevVersion(%q, %v, %q) = %q, not a pseudo-version", tt.base, when, tt.rev, v)
+		}
+	}
+}
+
+func TestNewerThan(t *testing.T) {
+	versions := []string{
+		"v1.0.0",
+		"v0.0.0-20191109021931-daa7c04131f5",
+		"v1.2.4-0.20200101000000-0123456789ab",
+		"v1.2.3-pre.0.20200615120000-0123456789ab+incompatible",
+		"v1.3.0-rc.1",
+	}
+	newer, err := NewerThan(versions, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("NewerThan: %v", err)
+	}
+	want := "v1.0.0 v1.2.3-pre.0.20200615120000-0123456789ab+incompatible v1.3.0-rc.1"
+	if got := strings.Join(newer, " "); got != want {
+		t.Errorf("NewerThan = %q, want %q", got, want)
+	}
+
+	for _, bad := range []string{"latest", "v0.0.0-20191399021931-daa7c04131f5"} {
+		if _, err := NewerThan([]string{"v1.0.0", bad}, time.Time{}); err == nil || !strings.Contains(err.Error(), bad) {
+			t.Errorf("NewerThan(%q) = %v, want error naming version", bad, err)
+		}
+	}
+}
+
+var canonicalPseudoTests = []struct {
+	in, out string
+	err     string
+}{
+	{"v0.0.0-20191109021931-daa7c04131f5", "v0.0.0-20191109021931-daa7c04131f5", ""},
+	{"v1.2.4-0.20191109021931-daa7c04131f5+meta", "v1.2.4-0.20191109021931-daa7c04131f5", ""},
+	{"v2.0.1-0.20191109021931-daa7c04131f5+incompatible", "v2.0.1-0.20191109021931-daa7c04131f5+incompatible", ""},
+	{"v1.2.3-pre.0.20191109021931-daa7c04131f5", "v1.2.3-pre.0.20191109021931-daa7c04131f5", ""},
+	{"latest", "", `pseudo-version "latest" invalid: not a semantic version`},
+	{"v1.2.3", "", `pseudo-version "v1.2.3" invalid: syntax error`},
+	{"v1.2.3-rc.1", "", `pseudo-version "v1.2.3-rc.1" invalid: syntax error`},
+	{"v0.0.0-2019110902193-daa7c04131f5", "", `pseudo-version "v0.0.0-2019110902193-daa7c04131f5" invalid: syntax error`},
+	{"v0.0.0-20191309021931-daa7c04131f5", "", `pseudo-version "v0.0.0-20191309021931-daa7c04131f5" invalid: malformed time "20191309021931"`},
+	{"v0.0.0-20191109021931-daa7c04131f", "", `pseudo-version "v0.0.0-20191109021931-daa7c04131f" invalid: revision "daa7c04131f" must be 12 lower-case hexadecimal digits`},
+	{"v0.0.0-20191109021931-DAA7C04131F5", "", `pseudo-version "v0.0.0-20191109021931-DAA7C04131F5" invalid: revision "DAA7C04131F5" must be 12 lower-case hexadecimal digits`},
+}
+
+func TestCanonicalPseudoVersion(t *testing.T) {
+	for _, tt := range canonicalPseudoTests {
+		out, err := CanonicalPseudoVersion(tt.in)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("CanonicalPseudoVersion(%q) = %q, %v, want error %q", tt.in, out, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || out != tt.out {
+			t.Errorf("CanonicalPseudoVersion(%q) = %q, %v, want %q, nil", tt.in, out, err, tt.out)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package module
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A sumLine is a single parsed line of a go.sum file.
+type sumLine struct {
+	mod  Version // Version may have a "/go.mod" suffix
+	hash string
+}
+
+// parseSumLine parses a go.sum line of the form "path version hash".
+func parseSumLine(line string) (sumLine, error) {
+	f := strings.Fields(line)
+	if len(f) != 3 {
+		return sumLine{}, fmt.Errorf("malformed go.sum line: want path, version, and hash")
+	}
+	if err := CheckPath(f[0]); err != nil {
+		return sumLine{}, err
+	}
+	if v := strings.TrimSuffix(f[1], "/go.mod"); v == "" || strings.Contains(v, "/") {
+		return sumLine{}, fmt.Errorf("malformed go.sum line: invalid version %q", f[1])
+	}
+	return sumLine{Version{f[0], f[1]}, f[2]}, nil
+}
+
+// formatSumLine returns the go.sum form of s, without a trailing newline.
+func formatSumLine(s sumLine) string {
+	return s.mod.Path + " " + s.mod.Version + " " + s.hash
+}
+
+// CanonicalizeSum returns the go.sum lines in lines in canonical form:
+// each line reformatted with single spaces between its fields,
+// duplicate lines removed, and the result sorted by path and version
+// as Sort would sort them, with a version's "/go.mod" line following
+// the version itself and lines for the same version ordered by hash.
+// Blank lines are ignored.
+// CanonicalizeSum returns an error naming the (1-based) number
+// of the first line it cannot parse.
+func CanonicalizeSum(lines []string) ([]string, error) {
+	var sums []sumLine
+	seen := make(map[sumLine]bool)
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		s, err := parseSumLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		if !seen[s] {
+			seen[s] = true
+			sums = append(sums, s)
+		}
+	}
+	sort.Slice(sums, func(i, j int) bool {
+		si, sj := sums[i], sums[j]
+		if si.mod != sj.mod {
+			return less(si.mod, sj.mod)
+		}
+		return si.hash < sj.hash
+	})
+	out := make([]string, len(sums))
+	for i, s := range sums {
+		out[i] = formatSumLine(s)
+	}
+	return out, nil
+}
@@ -0,0 +1,44 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package module
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCanonicalizeSum(t *testing.T) {
+	in := []string{
+		"rsc.io/sampler v1.3.0/go.mod h1:T1hPZKmBbMNahiBKFy5HrXp6adAjACjK9JXDnKaTXpA=",
+		"rsc.io/quote v1.5.2 h1:w5fcysjrx7yqtD/aO+QwRjYZOKnaM9Uh2b40tElTs3Y=",
+		"",
+		"rsc.io/sampler v1.3.0 h1:7uVkIFmeBqHfdjD+gZwtXXI+RODJ2Wc4O7MPEh/QiW4=",
+		"golang.org/x/text  v0.0.0-20170915032832-14c0d48ead0c\th1:qgOY6WgZOaTkIIMiVjBQcw93ERBE4m30iBm00nkL0i8=",
+		"rsc.io/sampler v1.10.0 h1:2cbzuYJGKlUrh3WslH0Hk4bSQcnLQ0CV/oYYM+fGbdk=",
+		"rsc.io/quote v1.5.2 h1:w5fcysjrx7yqtD/aO+QwRjYZOKnaM9Uh2b40tElTs3Y=",
+		"golang.org/x/text v0.0.0-20170915032832-14c0d48ead0c/go.mod h1:NqM8EUOU14njkJ3fqMW+pc6Ldnwhi/IjpwHt7yyuwOQ=",
+	}
+	want := strings.Join([]string{
+		"golang.org/x/text v0.0.0-20170915032832-14c0d48ead0c h1:qgOY6WgZOaTkIIMiVjBQcw93ERBE4m30iBm00nkL0i8=",
+		"golang.org/x/text v0.0.0-20170915032832-14c0d48ead0c/go.mod h1:NqM8EUOU14njkJ3fqMW+pc6Ldnwhi/IjpwHt7yyuwOQ=",
+		"rsc.io/quote v1.5.2 h1:w5fcysjrx7yqtD/aO+QwRjYZOKnaM9Uh2b40tElTs3Y=",
+		"rsc.io/sampler v1.3.0 h1:7uVkIFmeBqHfdjD+gZwtXXI+RODJ2Wc4O7MPEh/QiW4=",
+		"rsc.io/sampler v1.3.0/go.mod h1:T1hPZKmBbMNahiBKFy5HrXp6adAjACjK9JXDnKaTXpA=",
+		"rsc.io/sampler v1.10.0 h1:2cbzuYJGKlUrh3WslH0Hk4bSQcnLQ0CV/oYYM+fGbdk=",
+	}, "\n")
+
+	out, err := CanonicalizeSum(in)
+	if err != nil {
+		t.Fatalf("CanonicalizeSum: %v", err)
+	}
+	if got := strings.Join(out, "\n"); got != want {
+		t.Errorf("CanonicalizeSum:\nhave:\n%s\nwant:\n%s", got, want)
+	}
+
+	_, err = CanonicalizeSum([]string{in[0], "rsc.io/quote v1.5.2"})
+	if err == nil || !strings.HasPrefix(err.Error(), "line 2:") {
+		t.Errorf("CanonicalizeSum(bad line 2) = %v, want error for line 2", err)
+	}
+}
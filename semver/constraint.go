@@ -0,0 +1,165 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package semver
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A Constraint is a set of conditions that a semantic version may satisfy,
+// such as ">=v1.2.0 <v2.0.0".
+// The zero Constraint is satisfied by every valid semantic version.
+type Constraint struct {
+	comparators []comparator
+}
+
+// A comparator is a single condition in a Constraint,
+// comparing a version against a canonical semantic version.
+type comparator struct {
+	op      string // one of "=", "!=", "<", "<=", ">", ">="
+	version string
+}
+
+// ops lists the comparison operators accepted by ParseConstraint.
+// Longer operators precede their prefixes.
+var ops = []string{">=", "<=", "!=", ">", "<", "="}
+
+// ParseConstraint parses a constraint made up of comparators
+// separated by commas or spaces, all of which must hold.
+// Each comparator is an operator (=, !=, <, <=, >, or >=)
+// followed by a semantic version, as in ">=v1.2.0, <v2.0.0".
+// A version without an operator must match exactly.
+//
+// A comparator may also be a wildcard, written as a major version
+// or a major.minor version followed by ".x", as in "v1.x" or "v1.2.x",
+// with no operator. It matches every version, including prereleases,
+// with that major (and minor) version: "v1.x" is equivalent to
+// ">=v1.0.0-0 <v2.0.0-0", where v1.0.0-0 is the lowest possible
+// prerelease of v1.0.0.
+func ParseConstraint(s string) (Constraint, error) {
+	var c Constraint
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+	for i := 0; i < len(fields); i++ {
+		f := fields[i]
+		op := "="
+		hasOp := false
+		for _, o := range ops {
+			if strings.HasPrefix(f, o) {
+				op, f, hasOp = o, f[len(o):], true
+				break
+			}
+		}
+		if f == "" && i+1 < len(fields) {
+			// Operator separated from its version, as in ">= v1.2.0".
+			i++
+			f = fields[i]
+		}
+		if strings.HasSuffix(f, ".x") {
+			if hasOp {
+				return Constraint{}, fmt.Errorf("invalid constraint %q: operator %s not allowed with wildcard %q", s, op, f)
+			}
+			low, high, ok := wildcardRange(strings.TrimSuffix(f, ".x"))
+			if !ok {
+				return Constraint{}, fmt.Errorf("invalid constraint %q: invalid wildcard %q", s, f)
+			}
+			c.comparators = append(c.comparators, comparator{">=", low}, comparator{"<", high})
+			continue
+		}
+		if !IsValid(f) {
+			return Constraint{}, fmt.Errorf("invalid constraint %q: invalid semantic version %q", s, f)
+		}
+		c.comparators = append(c.comparators, comparator{op, Canonical(f)})
+	}
+	return c, nil
+}
+
+// wildcardRange returns the bounds low <= v < high of the versions
+// matching the wildcard prefix+".x", where prefix is "vN" or "vN.M".
+func wildcardRange(prefix string) (low, high string, ok bool) {
+	p, ok := parse(prefix)
+	if !ok || p.short == "" {
+		return "", "", false
+	}
+	if p.short == ".0.0" {
+		return "v" + p.major + ".0.0-0", "v" + incDecimal(p.major) + ".0.0-0", true
+	}
+	return "v" + p.major + "." + p.minor + ".0-0", "v" + p.major + "." + incDecimal(p.minor) + ".0-0", true
+}
+
+// Match reports whether v is a valid semantic version satisfying c.
+func (c Constraint) Match(v string) bool {
+	if !IsValid(v) {
+		return false
+	}
+	for _, cmp := range c.comparators {
+		if !cmp.match(v) {
+			return false
+		}
+	}
+	return true
+}
+
+func (cmp comparator) match(v string) bool {
+	c := Compare(v, cmp.version)
+	switch cmp.op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+// Highest returns the highest version in versions satisfying c,
+// preferring release versions to prereleases: a prerelease is returned
+// only if no release version satisfies c.
+// Invalid versions are ignored.
+// If no version satisfies c, Highest returns the empty string.
+func (c Constraint) Highest(versions []string) string {
+	var release, prerelease string
+	for _, v := range versions {
+		if !c.Match(v) {
+			continue
+		}
+		if Prerelease(v) == "" {
+			if release == "" || Compare(v, release) > 0 {
+				release = v
+			}
+		} else {
+			if prerelease == "" || Compare(v, prerelease) > 0 {
+				prerelease = v
+			}
+		}
+	}
+	if release != "" {
+		return release
+	}
+	return prerelease
+}
+
+// All returns the versions in versions satisfying c,
+// sorted as by Sort.
+// Invalid versions are ignored.
+func (c Constraint) All(versions []string) []string {
+	var list []string
+	for _, v := range versions {
+		if c.Match(v) {
+			list = append(list, v)
+		}
+	}
+	Sort(list)
+	return list
+}
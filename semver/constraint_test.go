@@ -0,0 +1,65 @@
+// Copyright 2019 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package semver
+
+import (
+	"strings"
+	"testing"
+)
+
+var constraintVersions = []string{
+	"v2.0.0",
+	"v1.2.0-rc.1",
+	"bad",
+	"v1.0.0",
+	"v1.10.0",
+	"v1.2.0",
+	"v2.1.0-beta",
+	"v1.2.1",
+}
+
+var constraintTests = []struct {
+	constraint string
+	highest    string
+	all        string
+}{
+	{"", "v2.0.0", "v1.0.0 v1.2.0-rc.1 v1.2.0 v1.2.1 v1.10.0 v2.0.0 v2.1.0-beta"},
+	{">=v1.2.0 <v2.0.0", "v1.10.0", "v1.2.0 v1.2.1 v1.10.0"},
+	{">= v1.2.0, < v2", "v1.10.0", "v1.2.0 v1.2.1 v1.10.0"},
+	{">v1.1,<=v1.2.0", "v1.2.0", "v1.2.0-rc.1 v1.2.0"},
+	{">v2.0.0", "v2.1.0-beta", "v2.1.0-beta"},
+	{"v1.2", "v1.2.0", "v1.2.0"},
+	{"!=v1.10.0 <v2", "v1.2.1", "v1.0.0 v1.2.0-rc.1 v1.2.0 v1.2.1"},
+	{">v3", "", ""},
+	{"v1.x", "v1.10.0", "v1.0.0 v1.2.0-rc.1 v1.2.0 v1.2.1 v1.10.0"},
+	{"v1.2.x", "v1.2.1", "v1.2.0-rc.1 v1.2.0 v1.2.1"},
+	{"v2.x", "v2.0.0", "v2.0.0 v2.1.0-beta"},
+	{"v1.x !=v1.2.1", "v1.10.0", "v1.0.0 v1.2.0-rc.1 v1.2.0 v1.10.0"},
+	{"v0.x", "", ""},
+}
+
+func TestConstraint(t *testing.T) {
+	for _, tt := range constraintTests {
+		c, err := ParseConstraint(tt.constraint)
+		if err != nil {
+			t.Errorf("ParseConstraint(%q): %v", tt.constraint, err)
+			continue
+		}
+		if h := c.Highest(constraintVersions); h != tt.highest {
+			t.Errorf("ParseConstraint(%q).Highest(...) = %q, want %q", tt.constraint, h, tt.highest)
+		}
+		if all := strings.Join(c.All(constraintVersions), " "); all != tt.all {
+			t.Errorf("ParseConstraint(%q).All(...) = %q, want %q", tt.constraint, all, tt.all)
+		}
+	}
+}
+
+func TestParseConstraintError(t *testing.T) {
+	for _, s := range []string{">=", ">=1.2.0", "~v1.2.0", "<v1 >", "v1.2.3.x", ">=v1.x", "=v1.x", "= v1.x", ">= v1.x", "!= v1.2.x", "x", "v1.x.x", "1.x"} {
+		if _, err := ParseConstraint(s); err == nil {
+			t.Errorf("ParseConstraint(%q) succeeded, want error", s)
+		}
+	}
+}
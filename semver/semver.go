@@ -22,6 +22,12 @@
 // as shorthands for vMAJOR.0.0 and vMAJOR.MINOR.0.
 package semver
 
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
 // parsed returns the parsed form of a semantic version string.
 type parsed struct {
 	major      string
@@ -58,6 +64,15 @@ func Canonical(v string) string {
 	return v
 }
 
+// IsCanonical reports whether v is a valid semantic version string
+// in canonical form, that is, whether Canonical(v) == v.
+// For example, "v1.2.0" and "v1.2.0-pre" are canonical,
+// but "v1.2" and "v1.2.0+meta" are not.
+func IsCanonical(v string) bool {
+	p, ok := parse(v)
+	return ok && p.short == "" && p.build == ""
+}
+
 // Major returns the major version prefix of the semantic version v.
 // For example, Major("v2.1.0") == "v2".
 // If v is an invalid semantic version string, Major returns the empty string.
@@ -95,9 +110,65 @@ func Prerelease(v string) string {
 	return pv.prerelease
 }
 
-// Build returns the build suffix of the semantic version v.
+// PrereleaseIdentifiers returns the dot-separated identifiers of the
+// prerelease suffix of the semantic version v, without the leading "-".
+// For example, PrereleaseIdentifiers("v1.2.3-rc.1") == []string{"rc", "1"}.
+// Numeric and alphanumeric identifiers alike are returned as strings,
+// exactly as written. If v is a release version or an invalid semantic
+// version string, PrereleaseIdentifiers returns nil.
+func PrereleaseIdentifiers(v string) []string {
+	pre := Prerelease(v)
+	if pre == "" {
+		return nil
+	}
+	return strings.Split(pre[1:], ".")
+}
+
+// ComparePrerelease compares two prerelease suffixes, as returned by
+// Prerelease, according to semantic version precedence.
+// The result is 0 if a == b, -1 if a < b, or +1 if a > b.
+// Identifiers are compared one at a time from left to right:
+// numeric identifiers compare numerically, so "-alpha.2" < "-alpha.10",
+// and sort before alphanumeric ones, which compare lexically.
+// The leading "-" may be omitted. The empty string denotes a release
+// and is greater than any prerelease.
+// An invalid prerelease is considered less than a valid one.
+// All invalid prereleases are considered equal.
+func ComparePrerelease(a, b string) int {
+	a, ok1 := checkPrerelease(a)
+	b, ok2 := checkPrerelease(b)
+	if !ok1 && !ok2 {
+		return 0
+	}
+	if !ok1 {
+		return -1
+	}
+	if !ok2 {
+		return +1
+	}
+	return comparePrerelease(a, b)
+}
+
+// checkPrerelease returns the prerelease suffix pre with a leading "-",
+// adding one if missing, and reports whether it is valid.
+func checkPrerelease(pre string) (string, bool) {
+	if pre == "" {
+		return "", true
+	}
+	if pre[0] != '-' {
+		pre = "-" + pre
+	}
+	if _, rest, ok := parsePrerelease(pre); !ok || rest != "" {
+		return pre, false
+	}
+	return pre, true
+}
+
+// Build returns the build suffix of the semantic version v,
+// including the leading "+".
 // For example, Build("v2.1.0+meta") == "+meta".
-// If v is an invalid semantic version string, Build returns the empty string.
+// If v has no build suffix or is an invalid semantic version string,
+// Build returns the empty string.
 func Build(v string) string {
 	pv, ok := parse(v)
 	if !ok {
@@ -106,6 +177,86 @@ func Build(v string) string {
 	return pv.build
 }
 
+// IsValidBuild reports whether b is a valid build suffix, as returned
+// by Build: a "+" followed by one or more non-empty, dot-separated
+// identifiers made up of ASCII letters, digits, and hyphens.
+// For example, "+git.abc123" and "+incompatible" are valid,
+// but "git.abc123", "+", and "+a..b" are not.
+func IsValidBuild(b string) bool {
+	_, rest, ok := parseBuild(b)
+	return ok && rest == ""
+}
+
+// IsUpgrade reports whether moving from version from to version to is
+// an upgrade: that is, whether Compare(to, from) > 0.
+// As in Compare, an invalid version is lower than any valid one,
+// so moving from an invalid version to a valid one is an upgrade.
+// Moving between two invalid versions is neither an upgrade nor a downgrade.
+func IsUpgrade(from, to string) bool {
+	return Compare(to, from) > 0
+}
+
+// IsDowngrade reports whether moving from version from to version to is
+// a downgrade: that is, whether Compare(to, from) < 0.
+// As in Compare, an invalid version is lower than any valid one,
+// so moving from a valid version to an invalid one is a downgrade.
+func IsDowngrade(from, to string) bool {
+	return Compare(to, from) < 0
+}
+
+// Relationship describes how the semantic versions a and b relate,
+// for explaining version differences to users. It returns one of:
+//
+//	"same"                  a and b have equal precedence, as for v1.2 and v1.2.0+meta
+//	"a is prerelease of b"  a is a prerelease of the release b, as for v1.2.0-rc.1 and v1.2.0
+//	"b is prerelease of a"  b is a prerelease of the release a
+//	"a is newer"            a has higher precedence than b, in any other way
+//	"b is newer"            b has higher precedence than a, in any other way
+//	"incomparable"          a or b is not a valid semantic version
+//
+// The prerelease relationships are those reported by IsPromotion.
+func Relationship(a, b string) string {
+	if !IsValid(a) || !IsValid(b) {
+		return "incomparable"
+	}
+	switch {
+	case IsPromotion(a, b):
+		return "a is prerelease of b"
+	case IsPromotion(b, a):
+		return "b is prerelease of a"
+	}
+	switch Compare(a, b) {
+	case +1:
+		return "a is newer"
+	case -1:
+		return "b is newer"
+	}
+	return "same"
+}
+
+// CrossesMajor reports whether moving between from and to, in either
+// direction, changes the major version, as from v1.9.0 to v2.0.0.
+// Build metadata is ignored, so v1.5.0 to v2.0.0+incompatible crosses
+// a major version even though both may live at the same module path.
+// If either version is invalid, CrossesMajor returns false.
+func CrossesMajor(from, to string) bool {
+	mf, mt := Major(from), Major(to)
+	return mf != "" && mt != "" && mf != mt
+}
+
+// IsPromotion reports whether to is the release corresponding to
+// the prerelease from: that is, whether from has a prerelease suffix,
+// to has none, and both have the same major, minor, and patch numbers.
+// For example, IsPromotion("v1.2.0-rc.1", "v1.2.0") == true.
+// Build metadata is ignored.
+func IsPromotion(from, to string) bool {
+	pf, ok1 := parse(from)
+	pt, ok2 := parse(to)
+	return ok1 && ok2 &&
+		pf.prerelease != "" && pt.prerelease == "" &&
+		pf.major == pt.major && pf.minor == pt.minor && pf.patch == pt.patch
+}
+
 // Compare returns an integer comparing two versions according to
 // according to semantic version precedence.
 // The result will be 0 if v == w, -1 if v < w, or +1 if v > w.
@@ -136,8 +287,307 @@ func Compare(v, w string) int {
 	return comparePrerelease(pv.prerelease, pw.prerelease)
 }
 
+// CompareTotal is like Compare but, when Compare reports v and w equal,
+// breaks the tie by comparing their build suffixes as strings.
+// For example, v1.0.0+a sorts before v1.0.0+b, and v1.0.0 before both.
+// This deliberately refines semantic versioning's precedence, under which
+// build metadata is ignored, to give a deterministic order suitable for
+// sorted storage. Compare remains the right choice for deciding which
+// of two versions is newer.
+func CompareTotal(v, w string) int {
+	if c := Compare(v, w); c != 0 {
+		return c
+	}
+	return strings.Compare(Build(v), Build(w))
+}
+
+// CompareDetailed is like Compare but also returns a short human-readable
+// reason naming the first component in which v and w differ,
+// such as "major: 1 < 2" or "prerelease: alpha.1 < alpha.2".
+// If v and w compare equal, the reason is "equal".
+// Build metadata never affects the result.
+func CompareDetailed(v, w string) (result int, reason string) {
+	pv, ok1 := parse(v)
+	pw, ok2 := parse(w)
+	if !ok1 && !ok2 {
+		return 0, "equal"
+	}
+	if !ok1 {
+		return -1, "invalid: " + v + " (" + pv.err + ") < " + w
+	}
+	if !ok2 {
+		return +1, "invalid: " + v + " > " + w + " (" + pw.err + ")"
+	}
+	if c := compareInt(pv.major, pw.major); c != 0 {
+		return c, "major: " + explain(pv.major, pw.major, c)
+	}
+	if c := compareInt(pv.minor, pw.minor); c != 0 {
+		return c, "minor: " + explain(pv.minor, pw.minor, c)
+	}
+	if c := compareInt(pv.patch, pw.patch); c != 0 {
+		return c, "patch: " + explain(pv.patch, pw.patch, c)
+	}
+	if c := comparePrerelease(pv.prerelease, pw.prerelease); c != 0 {
+		return c, "prerelease: " + explain(prereleaseName(pv.prerelease), prereleaseName(pw.prerelease), c)
+	}
+	return 0, "equal"
+}
+
+// explain formats x and y around the operator corresponding to c.
+func explain(x, y string, c int) string {
+	if c < 0 {
+		return x + " < " + y
+	}
+	return x + " > " + y
+}
+
+// prereleaseName returns the prerelease identifiers of x without the leading dash,
+// or "release" if x is empty.
+func prereleaseName(x string) string {
+	if x == "" {
+		return "release"
+	}
+	return x[1:]
+}
+
+// sortKeyWidth is the number of decimal digits used for each number in a SortKey.
+const sortKeyWidth = 20
+
+// SortKey returns a string encoding of the semantic version v such that
+// for any two valid versions v and w, comparing SortKey(v) and SortKey(w)
+// as plain strings gives the same result as Compare(v, w).
+// Version strings that compare equal, such as "v1.2" and "v1.2.0+meta",
+// have identical keys.
+//
+// The key consists of the major, minor, and patch numbers,
+// each zero-padded to 20 digits and separated by dots, followed by
+// "~" for a release or by "-" and the encoded prerelease for a prerelease.
+// In the encoded prerelease, identifiers are separated by commas,
+// numeric identifiers are written as "0" followed by the zero-padded number,
+// and other identifiers are written as "1" followed by the identifier.
+// Build metadata is discarded.
+//
+// SortKey returns an error if v is invalid or if any number in it
+// has more than 20 digits.
+func SortKey(v string) (string, error) {
+	p, ok := parse(v)
+	if !ok {
+		return "", fmt.Errorf("invalid semantic version %q: %s", v, p.err)
+	}
+	var b strings.Builder
+	for i, n := range []string{p.major, p.minor, p.patch} {
+		if i > 0 {
+			b.WriteByte('.')
+		}
+		if !padDecimal(&b, n) {
+			return "", fmt.Errorf("semantic version %q: number %s too long for sort key", v, n)
+		}
+	}
+	if p.prerelease == "" {
+		b.WriteByte('~')
+		return b.String(), nil
+	}
+	b.WriteByte('-')
+	for i, id := range strings.Split(p.prerelease[1:], ".") {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		if isNum(id) {
+			b.WriteByte('0')
+			if !padDecimal(&b, id) {
+				return "", fmt.Errorf("semantic version %q: number %s too long for sort key", v, id)
+			}
+		} else {
+			b.WriteByte('1')
+			b.WriteString(id)
+		}
+	}
+	return b.String(), nil
+}
+
+// padDecimal writes n to b zero-padded to sortKeyWidth digits.
+// It reports whether n fit in that width.
+func padDecimal(b *strings.Builder, n string) bool {
+	if len(n) > sortKeyWidth {
+		return false
+	}
+	b.WriteString(strings.Repeat("0", sortKeyWidth-len(n)))
+	b.WriteString(n)
+	return true
+}
+
+// CanonicalMap returns a map from the canonical form of each valid
+// version in versions to the original spelling of that version.
+// If several versions have the same canonical form, as "v1.2" and
+// "v1.2.0+meta" do, the map records the first of them.
+// Invalid versions are skipped.
+func CanonicalMap(versions []string) map[string]string {
+	m := make(map[string]string)
+	for _, v := range versions {
+		cv := Canonical(v)
+		if cv == "" {
+			continue
+		}
+		if _, ok := m[cv]; !ok {
+			m[cv] = v
+		}
+	}
+	return m
+}
+
+// ShortestDistinguishing returns a map from each version in versions
+// to the shortest prefix of its canonical form that identifies it
+// uniquely among the canonical forms of the other versions.
+// The candidate prefixes are tried in order of increasing specificity:
+// the major version ("v1"), the major and minor version ("v1.2"),
+// and finally the whole canonical version ("v1.2.3" or "v1.2.3-rc.1").
+// The first candidate that no other distinct canonical version shares
+// is chosen. For example, among v1.2.3, v1.4.0, and v2.0.0, the results
+// are v1.2, v1.4, and v2. Versions with the same canonical form, such as
+// "v1.2" and "v1.2.0+meta", count as one version: they cannot be told
+// apart from each other, and both map to the shortest prefix that tells
+// their shared canonical form apart from the others, so "v4" and
+// "v4.0.0+meta" both map to "v4" if no other version has major version 4.
+// Invalid versions map to themselves.
+func ShortestDistinguishing(versions []string) map[string]string {
+	prefixes := []func(string) string{Major, MajorMinor}
+	counts := make([]map[string]int, len(prefixes))
+	for i := range counts {
+		counts[i] = make(map[string]int)
+	}
+	seen := make(map[string]bool)
+	for _, v := range versions {
+		cv := Canonical(v)
+		if cv == "" || seen[cv] {
+			continue
+		}
+		seen[cv] = true
+		for i, prefix := range prefixes {
+			counts[i][prefix(cv)]++
+		}
+	}
+
+	m := make(map[string]string)
+	for _, v := range versions {
+		cv := Canonical(v)
+		if cv == "" {
+			m[v] = v
+			continue
+		}
+		m[v] = cv
+		for i, prefix := range prefixes {
+			if p := prefix(cv); counts[i][p] == 1 {
+				m[v] = p
+				break
+			}
+		}
+	}
+	return m
+}
+
+// IncMajor returns the next major release after the semantic version v,
+// with the minor and patch numbers zeroed: IncMajor("v1.4.2") == "v2.0.0".
+// As in common release tooling, a prerelease of a major release is
+// completed rather than skipped: IncMajor("v2.0.0-rc.1") == "v2.0.0".
+// The result never has a prerelease or build suffix.
+// v must be a canonical semantic version, a complete vMAJOR.MINOR.PATCH
+// version optionally followed by a prerelease suffix; shorthands such as
+// v1.4 and versions with build metadata such as v1.4.2+meta are rejected.
+func IncMajor(v string) (string, error) {
+	p, err := parseComplete(v)
+	if err != nil {
+		return "", err
+	}
+	if p.prerelease == "" || p.minor != "0" || p.patch != "0" {
+		p.major = incDecimal(p.major)
+	}
+	return "v" + p.major + ".0.0", nil
+}
+
+// IncMinor returns the next minor release after the semantic version v,
+// with the patch number zeroed: IncMinor("v1.4.2") == "v1.5.0".
+// A prerelease of a minor release is completed rather than skipped:
+// IncMinor("v1.5.0-rc.1") == "v1.5.0". The input rules are as for IncMajor.
+func IncMinor(v string) (string, error) {
+	p, err := parseComplete(v)
+	if err != nil {
+		return "", err
+	}
+	if p.prerelease == "" || p.patch != "0" {
+		p.minor = incDecimal(p.minor)
+	}
+	return "v" + p.major + "." + p.minor + ".0", nil
+}
+
+// IncPatch returns the next patch release after the semantic version v:
+// IncPatch("v1.4.2") == "v1.4.3". A prerelease is completed rather
+// than skipped: IncPatch("v1.4.2-rc1") == "v1.4.2".
+// The input rules are as for IncMajor.
+func IncPatch(v string) (string, error) {
+	p, err := parseComplete(v)
+	if err != nil {
+		return "", err
+	}
+	if p.prerelease == "" {
+		p.patch = incDecimal(p.patch)
+	}
+	return "v" + p.major + "." + p.minor + "." + p.patch, nil
+}
+
+// parseComplete parses v, requiring that it be a valid
+// semantic version in canonical form.
+func parseComplete(v string) (parsed, error) {
+	p, ok := parse(v)
+	if !ok {
+		return p, fmt.Errorf("invalid semantic version %q: %s", v, p.err)
+	}
+	if p.short != "" || p.build != "" {
+		return p, fmt.Errorf("semantic version %q is not canonical (want %s)", v, Canonical(v))
+	}
+	return p, nil
+}
+
+// incDecimal returns the decimal string incremented by 1.
+func incDecimal(decimal string) string {
+	digits := []byte(decimal)
+	i := len(digits) - 1
+	for ; i >= 0 && digits[i] == '9'; i-- {
+		digits[i] = '0'
+	}
+	if i >= 0 {
+		digits[i]++
+	} else {
+		digits[0] = '1'
+		digits = append(digits, '0')
+	}
+	return string(digits)
+}
+
+// ByVersion implements sort.Interface for sorting semantic version strings.
+type ByVersion []string
+
+func (vs ByVersion) Len() int      { return len(vs) }
+func (vs ByVersion) Swap(i, j int) { vs[i], vs[j] = vs[j], vs[i] }
+func (vs ByVersion) Less(i, j int) bool {
+	cmp := Compare(vs[i], vs[j])
+	if cmp != 0 {
+		return cmp < 0
+	}
+	return vs[i] < vs[j]
+}
+
+// Sort sorts a list of semantic version strings using ByVersion:
+// in increasing order as reported by Compare, with versions that
+// Compare considers equal, such as v1.2 and v1.2.0, ordered as strings.
+// Invalid versions sort before all valid ones, in string order.
+func Sort(list []string) {
+	sort.Sort(ByVersion(list))
+}
+
 // Max canonicalizes its arguments and then returns the version string
-// that compares greater.
+// that compares greater. Because Compare orders invalid versions before
+// valid ones, if only one argument is valid, Max returns it (canonicalized);
+// if neither is valid, Max returns the empty string.
 func Max(v, w string) string {
 	v = Canonical(v)
 	w = Canonical(w)
@@ -147,6 +597,190 @@ func Max(v, w string) string {
 	return w
 }
 
+// Min canonicalizes its arguments and then returns the version string
+// that compares lesser. Like Max, if only one argument is valid,
+// Min returns it (canonicalized), rather than treating the invalid
+// version as the lowest; if neither is valid, Min returns the empty string.
+func Min(v, w string) string {
+	v = Canonical(v)
+	w = Canonical(w)
+	switch {
+	case v == "":
+		return w
+	case w == "":
+		return v
+	case Compare(v, w) < 0:
+		return v
+	}
+	return w
+}
+
+// HighestWithinMajor returns the highest version in available that
+// has the same major version as current and is greater than current,
+// preferring releases: a prerelease is returned only if no greater
+// release is available. If no such version is available, or current
+// is invalid, HighestWithinMajor returns current.
+// Invalid versions in available are ignored.
+// The result never crosses a major version boundary; for example,
+// HighestWithinMajor("v1.2.0", []string{"v1.3.0", "v2.0.0"}) == "v1.3.0".
+func HighestWithinMajor(current string, available []string) string {
+	major := Major(current)
+	if major == "" {
+		return current
+	}
+	var release, prerelease string
+	for _, v := range available {
+		if Major(v) != major || Compare(v, current) <= 0 {
+			continue
+		}
+		if Prerelease(v) == "" {
+			if release == "" || Compare(v, release) > 0 {
+				release = v
+			}
+		} else if prerelease == "" || Compare(v, prerelease) > 0 {
+			prerelease = v
+		}
+	}
+	if release != "" {
+		return release
+	}
+	if prerelease != "" {
+		return prerelease
+	}
+	return current
+}
+
+// UpgradeDistance returns the number of distinct release versions in
+// available that lie strictly between from and to, as a rough measure
+// of how far behind to a dependency at version from is.
+// Prereleases are not counted, since they are not usually offered as
+// upgrades; see UpgradeDistancePrerelease to count them too.
+// Versions that compare equal, such as v1.2 and v1.2.0, count once,
+// and invalid versions are ignored.
+// UpgradeDistance returns an error if from or to is not in available
+// or if from is greater than to.
+func UpgradeDistance(from, to string, available []string) (int, error) {
+	return upgradeDistance(from, to, available, false)
+}
+
+// UpgradeDistancePrerelease is like UpgradeDistance
+// but counts prerelease versions as well as releases.
+func UpgradeDistancePrerelease(from, to string, available []string) (int, error) {
+	return upgradeDistance(from, to, available, true)
+}
+
+func upgradeDistance(from, to string, available []string, prerelease bool) (int, error) {
+	haveFrom, haveTo := false, false
+	between := make(map[string]bool)
+	for _, v := range available {
+		if !IsValid(v) {
+			continue
+		}
+		cf, ct := Compare(v, from), Compare(v, to)
+		haveFrom = haveFrom || cf == 0
+		haveTo = haveTo || ct == 0
+		if cf > 0 && ct < 0 && (prerelease || Prerelease(v) == "") {
+			between[Canonical(v)] = true
+		}
+	}
+	if !haveFrom {
+		return 0, fmt.Errorf("version %q not in available versions", from)
+	}
+	if !haveTo {
+		return 0, fmt.Errorf("version %q not in available versions", to)
+	}
+	if Compare(from, to) > 0 {
+		return 0, fmt.Errorf("version %q is greater than %q", from, to)
+	}
+	return len(between), nil
+}
+
+// SortWithChannels sorts versions in increasing order like Compare,
+// except that prereleases of the same major, minor, and patch version
+// are ordered first by their first prerelease identifier, the channel,
+// according to channelOrder. For example, with channelOrder
+// []string{"dev", "preview", "stable"}, v1.0.0-dev.9 < v1.0.0-preview.1.
+// Channels listed in channelOrder sort in that order and before all
+// unlisted channels, which are ordered among themselves by the usual
+// precedence rules, so that numeric channels sort before alphanumeric ones.
+// A channel name must match the identifier exactly, so listing "1"
+// affects only prereleases like v1.0.0-1.x.
+// Prereleases in the same channel are ordered by their remaining
+// identifiers using the usual precedence rules.
+// A release still sorts after all of its prereleases.
+// Invalid versions sort before all valid ones, in string order.
+func SortWithChannels(versions []string, channelOrder []string) {
+	rank := make(map[string]int, len(channelOrder))
+	for i, ch := range channelOrder {
+		if _, ok := rank[ch]; !ok {
+			rank[ch] = i
+		}
+	}
+	sort.SliceStable(versions, func(i, j int) bool {
+		return compareChannels(versions[i], versions[j], rank) < 0
+	})
+}
+
+// compareChannels compares v and w for SortWithChannels,
+// given the rank of each listed channel.
+func compareChannels(v, w string, rank map[string]int) int {
+	pv, ok1 := parse(v)
+	pw, ok2 := parse(w)
+	if !ok1 || !ok2 {
+		switch {
+		case ok1:
+			return +1
+		case ok2:
+			return -1
+		case v < w:
+			return -1
+		case v > w:
+			return +1
+		}
+		return 0
+	}
+	if c := compareInt(pv.major, pw.major); c != 0 {
+		return c
+	}
+	if c := compareInt(pv.minor, pw.minor); c != 0 {
+		return c
+	}
+	if c := compareInt(pv.patch, pw.patch); c != 0 {
+		return c
+	}
+	x, y := pv.prerelease, pw.prerelease
+	if x == "" || y == "" {
+		return comparePrerelease(x, y)
+	}
+	cx, rx := nextIdent(x[1:])
+	cy, ry := nextIdent(y[1:])
+	ix, okx := rank[cx]
+	iy, oky := rank[cy]
+	switch {
+	case okx && oky && ix != iy:
+		if ix < iy {
+			return -1
+		}
+		return +1
+	case okx && !oky:
+		return -1
+	case !okx && oky:
+		return +1
+	case cx != cy:
+		return comparePrerelease("-"+cx, "-"+cy)
+	}
+	// Same channel: compare remaining identifiers.
+	switch {
+	case rx == ry:
+		return 0
+	case rx == "":
+		return -1
+	case ry == "":
+		return +1
+	}
+	return comparePrerelease(rx, ry)
+}
+
 func parse(v string) (p parsed, ok bool) {
 	if v == "" || v[0] != 'v' {
 		p.err = "missing v prefix"
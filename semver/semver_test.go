@@ -5,6 +5,8 @@
 package semver
 
 import (
+	"math/rand"
+	"sort"
 	"strings"
 	"testing"
 )
@@ -65,6 +67,16 @@ func TestCanonical(t *testing.T) {
 	}
 }
 
+func TestIsCanonical(t *testing.T) {
+	for _, tt := range tests {
+		ok := IsCanonical(tt.in)
+		want := tt.out != "" && tt.out == tt.in
+		if ok != want {
+			t.Errorf("IsCanonical(%q) = %v, want %v", tt.in, ok, want)
+		}
+	}
+}
+
 func TestMajor(t *testing.T) {
 	for _, tt := range tests {
 		out := Major(tt.in)
@@ -120,6 +132,70 @@ func TestPrerelease(t *testing.T) {
 	}
 }
 
+func TestPrereleaseIdentifiers(t *testing.T) {
+	for _, tt := range tests {
+		ids := PrereleaseIdentifiers(tt.in)
+		var want []string
+		if pre := Prerelease(tt.in); pre != "" {
+			want = strings.Split(pre[1:], ".")
+		}
+		if strings.Join(ids, "|") != strings.Join(want, "|") || (ids == nil) != (want == nil) {
+			t.Errorf("PrereleaseIdentifiers(%q) = %q, want %q", tt.in, ids, want)
+		}
+	}
+	ids := PrereleaseIdentifiers("v1.2.3-rc.01a.10+meta.1")
+	if strings.Join(ids, "|") != "rc|01a|10" {
+		t.Errorf("PrereleaseIdentifiers(%q) = %q, want [rc 01a 10]", "v1.2.3-rc.01a.10+meta.1", ids)
+	}
+}
+
+var comparePrereleaseTests = []struct {
+	a, b string
+	out  int
+}{
+	{"-alpha.2", "-alpha.10", -1},
+	{"alpha.10", "-alpha.2", +1},
+	{"-alpha", "alpha", 0},
+	{"-alpha", "-alpha.1", -1},
+	{"-alpha.1", "-alpha.beta", -1},
+	{"-beta.11", "-rc.1", -1},
+	{"-rc.1", "", -1},
+	{"", "", 0},
+	{"-01", "-1", -1},
+	{"-alpha..1", "-alpha", -1},
+	{"-alpha", "bad!", +1},
+	{"-alpha+meta", "-alpha", -1},
+	{"bad!", "-x.", 0},
+}
+
+func TestComparePrerelease(t *testing.T) {
+	for _, tt := range comparePrereleaseTests {
+		if out := ComparePrerelease(tt.a, tt.b); out != tt.out {
+			t.Errorf("ComparePrerelease(%q, %q) = %d, want %d", tt.a, tt.b, out, tt.out)
+		}
+		if out := ComparePrerelease(tt.b, tt.a); out != -tt.out {
+			t.Errorf("ComparePrerelease(%q, %q) = %d, want %d", tt.b, tt.a, out, -tt.out)
+		}
+	}
+	// For versions with equal major, minor, and patch numbers,
+	// ComparePrerelease must agree with Compare.
+	for _, tt := range tests {
+		for _, tt1 := range tests {
+			if tt.out == "" || tt1.out == "" {
+				continue
+			}
+			core := strings.TrimSuffix(Canonical(tt.in), Prerelease(tt.in))
+			core1 := strings.TrimSuffix(Canonical(tt1.in), Prerelease(tt1.in))
+			if core != core1 {
+				continue
+			}
+			if out, want := ComparePrerelease(Prerelease(tt.in), Prerelease(tt1.in)), Compare(tt.in, tt1.in); out != want {
+				t.Errorf("ComparePrerelease(%q, %q) = %d, want %d", Prerelease(tt.in), Prerelease(tt1.in), out, want)
+			}
+		}
+	}
+}
+
 func TestBuild(t *testing.T) {
 	for _, tt := range tests {
 		build := Build(tt.in)
@@ -135,6 +211,38 @@ func TestBuild(t *testing.T) {
 	}
 }
 
+var isValidBuildTests = []struct {
+	in string
+	ok bool
+}{
+	{"+meta", true},
+	{"+git.abc123", true},
+	{"+incompatible", true},
+	{"+0.build-1.007", true},
+	{"", false},
+	{"+", false},
+	{"meta", false},
+	{"-meta", false},
+	{"+a..b", false},
+	{"+a.", false},
+	{"+.a", false},
+	{"+a_b", false},
+	{"+a+b", false},
+}
+
+func TestIsValidBuild(t *testing.T) {
+	for _, tt := range isValidBuildTests {
+		if ok := IsValidBuild(tt.in); ok != tt.ok {
+			t.Errorf("IsValidBuild(%q) = %v, want %v", tt.in, ok, tt.ok)
+		}
+	}
+	for _, tt := range tests {
+		if b := Build(tt.in); b != "" && !IsValidBuild(b) {
+			t.Errorf("IsValidBuild(Build(%q)) = false, want true", tt.in)
+		}
+	}
+}
+
 func TestCompare(t *testing.T) {
 	for i, ti := range tests {
 		for j, tj := range tests {
@@ -154,6 +262,151 @@ func TestCompare(t *testing.T) {
 	}
 }
 
+var compareTotalTests = []struct {
+	v, w string
+	out  int
+}{
+	{"v1.0.0", "v1.0.1", -1},
+	{"v1.0.0+b", "v1.0.1+a", -1},
+	{"v1.0.0", "v1.0.0+a", -1},
+	{"v1.0.0+a", "v1.0.0+b", -1},
+	{"v1.0.0+b", "v1.0.0+a", +1},
+	{"v1.0.0+a", "v1.0.0+a", 0},
+	{"v1.0.0-rc.1+z", "v1.0.0+a", -1},
+	{"v1.2", "v1.2.0", 0},
+	{"bad", "v1.0.0+a", -1},
+}
+
+func TestCompareTotal(t *testing.T) {
+	for _, tt := range compareTotalTests {
+		if c := CompareTotal(tt.v, tt.w); c != tt.out {
+			t.Errorf("CompareTotal(%q, %q) = %d, want %d", tt.v, tt.w, c, tt.out)
+		}
+		if c := CompareTotal(tt.w, tt.v); c != -tt.out {
+			t.Errorf("CompareTotal(%q, %q) = %d, want %d", tt.w, tt.v, c, -tt.out)
+		}
+	}
+}
+
+var compareDetailedTests = []struct {
+	v, w   string
+	result int
+	reason string
+}{
+	{"v1.0.0", "v2.0.0", -1, "major: 1 < 2"},
+	{"v1.3.0", "v1.2.9", +1, "minor: 3 > 2"},
+	{"v1.2.3", "v1.2.10", -1, "patch: 3 < 10"},
+	{"v1.2.3-a.1", "v1.2.3-a.2", -1, "prerelease: a.1 < a.2"},
+	{"v1.2.3", "v1.2.3-rc.1", +1, "prerelease: release > rc.1"},
+	{"v1.2", "v1.2.0+meta", 0, "equal"},
+	{"bad", "v1.0.0", -1, "invalid: bad (missing v prefix) < v1.0.0"},
+	{"v1.0.0", "v1.x", +1, "invalid: v1.0.0 > v1.x (bad minor version)"},
+	{"bad", "worse", 0, "equal"},
+}
+
+func TestCompareDetailed(t *testing.T) {
+	for _, tt := range compareDetailedTests {
+		result, reason := CompareDetailed(tt.v, tt.w)
+		if result != tt.result || reason != tt.reason {
+			t.Errorf("CompareDetailed(%q, %q) = %d, %q, want %d, %q", tt.v, tt.w, result, reason, tt.result, tt.reason)
+		}
+		if c := Compare(tt.v, tt.w); c != result {
+			t.Errorf("CompareDetailed(%q, %q) = %d, but Compare = %d", tt.v, tt.w, result, c)
+		}
+	}
+}
+
+var upgradeTests = []struct {
+	from, to string
+	up, down bool
+}{
+	{"v1.0.0", "v1.0.1", true, false},
+	{"v1.0.1", "v1.0.0", false, true},
+	{"v1.2.0-rc.1", "v1.2.0", true, false},
+	{"v1.2", "v1.2.0+meta", false, false},
+	{"bad", "v0.0.1", true, false},
+	{"v0.0.1", "bad", false, true},
+	{"bad", "worse", false, false},
+}
+
+func TestIsUpgrade(t *testing.T) {
+	for _, tt := range upgradeTests {
+		if up := IsUpgrade(tt.from, tt.to); up != tt.up {
+			t.Errorf("IsUpgrade(%q, %q) = %v, want %v", tt.from, tt.to, up, tt.up)
+		}
+		if down := IsDowngrade(tt.from, tt.to); down != tt.down {
+			t.Errorf("IsDowngrade(%q, %q) = %v, want %v", tt.from, tt.to, down, tt.down)
+		}
+	}
+}
+
+var relationshipTests = []struct {
+	a, b string
+	out  string
+}{
+	{"v1.2.0", "v1.2.0", "same"},
+	{"v1.2", "v1.2.0+meta", "same"},
+	{"v1.2.0-rc.1", "v1.2.0", "a is prerelease of b"},
+	{"v1.2.0", "v1.2.0-rc.1", "b is prerelease of a"},
+	{"v1.3.0", "v1.2.0", "a is newer"},
+	{"v1.2.0-rc.1", "v1.1.9", "a is newer"},
+	{"v1.2.0-rc.1", "v1.2.0-rc.2", "b is newer"},
+	{"v1.2.0", "v1.2.1-rc.1", "b is newer"},
+	{"bad", "v1.0.0", "incomparable"},
+	{"v1.0.0", "v1.x", "incomparable"},
+}
+
+func TestRelationship(t *testing.T) {
+	for _, tt := range relationshipTests {
+		if out := Relationship(tt.a, tt.b); out != tt.out {
+			t.Errorf("Relationship(%q, %q) = %q, want %q", tt.a, tt.b, out, tt.out)
+		}
+	}
+}
+
+var crossesMajorTests = []struct {
+	from, to string
+	ok       bool
+}{
+	{"v1.9.0", "v2.0.0", true},
+	{"v2.0.0", "v1.9.0", true},
+	{"v1.5.0", "v2.0.0+incompatible", true},
+	{"v0.9.0", "v1.0.0", true},
+	{"v1.2.0", "v1.9.9-rc.1", false},
+	{"v1", "v1.2.3", false},
+	{"v1.2.0", "bad", false},
+	{"bad", "worse", false},
+}
+
+func TestCrossesMajor(t *testing.T) {
+	for _, tt := range crossesMajorTests {
+		if ok := CrossesMajor(tt.from, tt.to); ok != tt.ok {
+			t.Errorf("CrossesMajor(%q, %q) = %v, want %v", tt.from, tt.to, ok, tt.ok)
+		}
+	}
+}
+
+var promotionTests = []struct {
+	from, to string
+	ok       bool
+}{
+	{"v1.2.0-rc.1", "v1.2.0", true},
+	{"v1.2.0-rc.1", "v1.2.0+meta", true},
+	{"v1.2.0-rc.1", "v1.2", true},
+	{"v1.2.0-rc.1", "v1.2.1", false},
+	{"v1.2.0-rc.1", "v1.2.0-rc.2", false},
+	{"v1.2.0", "v1.2.0", false},
+	{"v1.2.0-rc.1", "bad", false},
+}
+
+func TestIsPromotion(t *testing.T) {
+	for _, tt := range promotionTests {
+		if ok := IsPromotion(tt.from, tt.to); ok != tt.ok {
+			t.Errorf("IsPromotion(%q, %q) = %v, want %v", tt.from, tt.to, ok, tt.ok)
+		}
+	}
+}
+
 func TestMax(t *testing.T) {
 	for i, ti := range tests {
 		for j, tj := range tests {
@@ -169,6 +422,64 @@ func TestMax(t *testing.T) {
 	}
 }
 
+func TestMin(t *testing.T) {
+	for i, ti := range tests {
+		for j, tj := range tests {
+			min := Min(ti.in, tj.in)
+			want := Canonical(ti.in)
+			if j < i && tj.out != "" || ti.out == "" {
+				want = Canonical(tj.in)
+			}
+			if min != want {
+				t.Errorf("Min(%q, %q) = %q, want %q", ti.in, tj.in, min, want)
+			}
+		}
+	}
+}
+
+var incTests = []struct {
+	in                  string
+	major, minor, patch string // empty means error
+}{
+	{"v1.4.2", "v2.0.0", "v1.5.0", "v1.4.3"},
+	{"v0.0.0", "v1.0.0", "v0.1.0", "v0.0.1"},
+	{"v1.4.2-rc1", "v2.0.0", "v1.5.0", "v1.4.2"},
+	{"v1.5.0-rc.1", "v2.0.0", "v1.5.0", "v1.5.0"},
+	{"v2.0.0-rc.1", "v2.0.0", "v2.0.0", "v2.0.0"},
+	{"v9.99.999", "v10.0.0", "v9.100.0", "v9.99.1000"},
+	{"v1.4", "", "", ""},
+	{"v2.0.0-rc.1+meta", "", "", ""},
+	{"v1.4.2+incompatible", "", "", ""},
+	{"v1", "", "", ""},
+	{"1.4.2", "", "", ""},
+	{"bad", "", "", ""},
+}
+
+func TestInc(t *testing.T) {
+	for _, tt := range incTests {
+		for _, f := range []struct {
+			name string
+			fn   func(string) (string, error)
+			want string
+		}{
+			{"IncMajor", IncMajor, tt.major},
+			{"IncMinor", IncMinor, tt.minor},
+			{"IncPatch", IncPatch, tt.patch},
+		} {
+			out, err := f.fn(tt.in)
+			if f.want == "" {
+				if err == nil {
+					t.Errorf("%s(%q) = %q, want error", f.name, tt.in, out)
+				}
+				continue
+			}
+			if err != nil || out != f.want {
+				t.Errorf("%s(%q) = %q, %v, want %q, nil", f.name, tt.in, out, err, f.want)
+			}
+		}
+	}
+}
+
 var (
 	v1 = "v1.0.0+metadata-dash"
 	v2 = "v1.0.0+metadata-dash1"
@@ -181,3 +492,183 @@ func BenchmarkCompare(b *testing.B) {
 		}
 	}
 }
+
+func TestSort(t *testing.T) {
+	versions := make([]string, len(tests))
+	for i, test := range tests {
+		versions[i] = test.in
+	}
+	rand.Shuffle(len(versions), func(i, j int) { versions[i], versions[j] = versions[j], versions[i] })
+	Sort(versions)
+	if !sort.IsSorted(ByVersion(versions)) {
+		t.Errorf("list is not sorted:\n%s", strings.Join(versions, "\n"))
+	}
+	for i := 1; i < len(versions); i++ {
+		if !IsValid(versions[i-1]) && IsValid(versions[i]) {
+			continue
+		}
+		if IsValid(versions[i-1]) && !IsValid(versions[i]) {
+			t.Errorf("invalid version %q sorted after valid %q", versions[i], versions[i-1])
+		}
+	}
+
+	list := []string{"v1.2.0", "v1.10.0", "bad", "v1.2", "v1.2.0-rc.1", "abc"}
+	Sort(list)
+	if got, want := strings.Join(list, " "), "abc bad v1.2.0-rc.1 v1.2 v1.2.0 v1.10.0"; got != want {
+		t.Errorf("Sort = %q, want %q", got, want)
+	}
+}
+
+func TestSortWithChannels(t *testing.T) {
+	versions := []string{
+		"v1.0.0",
+		"v1.0.0-stable.2",
+		"bad",
+		"v1.0.0-dev.10",
+		"v1.0.0-preview",
+		"v1.0.0-alpha",
+		"v0.9.0",
+		"v1.0.0-dev.9",
+		"v1.0.0-stable.2.1",
+		"v1.0.0-1",
+		"v1.0.0-zeta",
+		"v1.0.0-preview.1",
+		"",
+	}
+	SortWithChannels(versions, []string{"dev", "preview", "stable"})
+	got := strings.Join(versions, " ")
+	want := " bad v0.9.0 v1.0.0-dev.9 v1.0.0-dev.10 v1.0.0-preview v1.0.0-preview.1 v1.0.0-stable.2 v1.0.0-stable.2.1 v1.0.0-1 v1.0.0-alpha v1.0.0-zeta v1.0.0"
+	if got != want {
+		t.Errorf("SortWithChannels:\nhave %s\nwant %s", got, want)
+	}
+}
+
+var highestWithinMajorTests = []struct {
+	current   string
+	available []string
+	want      string
+}{
+	{"v1.2.0", []string{"v1.3.0", "v2.0.0", "v1.10.1", "bad"}, "v1.10.1"},
+	{"v1.2.0", []string{"v1.3.0", "v1.4.0-rc.1"}, "v1.3.0"},
+	{"v1.2.0", []string{"v1.4.0-rc.1", "v1.3.0-rc.1", "v2.0.0"}, "v1.4.0-rc.1"},
+	{"v1.2.0", []string{"v1.1.0", "v2.0.0"}, "v1.2.0"},
+	{"v1.2.0", nil, "v1.2.0"},
+	{"v1.2.0-rc.1", []string{"v1.2.0"}, "v1.2.0"},
+	{"v0.1.0", []string{"v0.2.0", "v1.0.0"}, "v0.2.0"},
+	{"bad", []string{"v1.0.0"}, "bad"},
+}
+
+func TestHighestWithinMajor(t *testing.T) {
+	for _, tt := range highestWithinMajorTests {
+		if v := HighestWithinMajor(tt.current, tt.available); v != tt.want {
+			t.Errorf("HighestWithinMajor(%q, %q) = %q, want %q", tt.current, tt.available, v, tt.want)
+		}
+	}
+}
+
+func TestSortKey(t *testing.T) {
+	for _, ti := range tests {
+		ki, err := SortKey(ti.in)
+		if (err == nil) != (ti.out != "") {
+			t.Errorf("SortKey(%q) error = %v, want error %v", ti.in, err, ti.out == "")
+		}
+		if err != nil {
+			continue
+		}
+		for _, tj := range tests {
+			kj, err := SortKey(tj.in)
+			if err != nil {
+				continue
+			}
+			want := Compare(ti.in, tj.in)
+			cmp := strings.Compare(ki, kj)
+			if cmp != want {
+				t.Errorf("SortKey(%q) = %q, SortKey(%q) = %q: compare %d, want %d", ti.in, ki, tj.in, kj, cmp, want)
+			}
+		}
+	}
+
+	// Additional prerelease orderings not covered by tests.
+	ordered := []string{"v1.0.0-a", "v1.0.0-a.b", "v1.0.0-a-", "v1.0.0-a-b", "v1.0.0-ab", "v9.0.0", "v10.0.0"}
+	for i := 1; i < len(ordered); i++ {
+		ki, _ := SortKey(ordered[i-1])
+		kj, _ := SortKey(ordered[i])
+		if Compare(ordered[i-1], ordered[i]) >= 0 || ki >= kj {
+			t.Errorf("SortKey(%q) = %q, not less than SortKey(%q) = %q", ordered[i-1], ki, ordered[i], kj)
+		}
+	}
+
+	if k, err := SortKey("v123456789012345678901.0.0"); err == nil {
+		t.Errorf("SortKey(21-digit major) = %q, want error", k)
+	}
+}
+
+var upgradeDistanceTests = []struct {
+	from, to string
+	dist     int
+	distPre  int
+	err      bool
+}{
+	{"v1.0.0", "v1.3.0", 2, 3, false},
+	{"v1.0.0", "v1.0.0", 0, 0, false},
+	{"v1.0", "v2.0.0", 3, 5, false},
+	{"v1.1.0", "v1.2.0", 0, 1, false},
+	{"v1.3.0", "v1.0.0", 0, 0, true},
+	{"v1.0.0", "v3.0.0", 0, 0, true},
+	{"v0.9.0", "v1.0.0", 0, 0, true},
+}
+
+func TestUpgradeDistance(t *testing.T) {
+	available := []string{"v1.0.0", "v1.1.0", "v1.2.0-rc.1", "bad", "v1.2.0", "v1.2", "v1.3.0", "v2.0.0-beta", "v2.0.0"}
+	for _, tt := range upgradeDistanceTests {
+		dist, err := UpgradeDistance(tt.from, tt.to, available)
+		if dist != tt.dist || (err != nil) != tt.err {
+			t.Errorf("UpgradeDistance(%q, %q) = %d, %v, want %d, error %v", tt.from, tt.to, dist, err, tt.dist, tt.err)
+		}
+		dist, err = UpgradeDistancePrerelease(tt.from, tt.to, available)
+		if dist != tt.distPre || (err != nil) != tt.err {
+			t.Errorf("UpgradeDistancePrerelease(%q, %q) = %d, %v, want %d, error %v", tt.from, tt.to, dist, err, tt.distPre, tt.err)
+		}
+	}
+}
+
+func TestShortestDistinguishing(t *testing.T) {
+	versions := []string{"v1.2.3", "v1.4.0", "v1.4.1", "v2.0.0", "v3.1.0-rc.1", "v3.1.0", "v4", "v4.0.0+meta", "bad"}
+	want := map[string]string{
+		"v1.2.3":      "v1.2",
+		"v1.4.0":      "v1.4.0",
+		"v1.4.1":      "v1.4.1",
+		"v2.0.0":      "v2",
+		"v3.1.0-rc.1": "v3.1.0-rc.1",
+		"v3.1.0":      "v3.1.0",
+		"v4":          "v4",
+		"v4.0.0+meta": "v4",
+		"bad":         "bad",
+	}
+	got := ShortestDistinguishing(versions)
+	if len(got) != len(want) {
+		t.Errorf("ShortestDistinguishing returned %d entries, want %d", len(got), len(want))
+	}
+	for v, w := range want {
+		if got[v] != w {
+			t.Errorf("ShortestDistinguishing(...)[%q] = %q, want %q", v, got[v], w)
+		}
+	}
+}
+
+func TestCanonicalMap(t *testing.T) {
+	m := CanonicalMap([]string{"v1.2", "bad", "v1.2.0+meta", "v1", "v1.0.0-rc.1", "v1.0.0", ""})
+	want := map[string]string{
+		"v1.2.0":      "v1.2",
+		"v1.0.0":      "v1",
+		"v1.0.0-rc.1": "v1.0.0-rc.1",
+	}
+	if len(m) != len(want) {
+		t.Errorf("CanonicalMap(...) = %v, want %v", m, want)
+	}
+	for cv, v := range want {
+		if m[cv] != v {
+			t.Errorf("CanonicalMap(...)[%q] = %q, want %q", cv, m[cv], v)
+		}
+	}
+}